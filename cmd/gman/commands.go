@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+// command is one of gman's subcommands for reading the repo. They do the
+// same as gman's own flags, eg. gman list -n ns is gman -n ns, but each
+// has only the flags which apply to it, and its own help.
+type command struct {
+	name string
+	// usage is the synopsis of each form of the command, one per line
+	usage string
+	// flags defines the command's flags. Most set the same variables as
+	// gman's own flags, so the rest of main reads them the same way.
+	flags func(fs *flag.FlagSet)
+	// args reports whether the command can be run with n args
+	args func(n int) bool
+	// update is set if the repo is updated, if due, before running
+	update bool
+	run    func(ctx context.Context, m *gman.Gman, args []string)
+}
+
+// commandSummaries are all of gman's subcommands, in the order of gman -h
+var commandSummaries = [][2]string{
+	{"list", "list the apps in a namespace"},
+	{"show", "show the page of an app"},
+	{"search", "search the apps"},
+	{"releases", "list the releases, or show the notes of one"},
+	{"namespaces", "list the namespaces"},
+	{"serve", "run the web server"},
+	{"update", "update the repo now"},
+	{"config", "get, set and validate the config"},
+	{"init", "set up the config"},
+	{"new", "create a gman repo, or an app or release in it"},
+	{"lint", "check a gman repo for mistakes"},
+	{"links", "check the links in a gman repo"},
+	{"doctor", "check the install, config and local repo"},
+	{"completion", "print the completion script of a shell"},
+}
+
+// usage is gman -h
+func usage() {
+	fmt.Fprintf(gmancmd.Output(), `Usage of gman:
+  gman [flags] [app]             show the page of app, or list the apps if there is none
+  gman [flags] command [args]    run a command, see gman command -h
+
+Commands:
+`)
+	for _, c := range commandSummaries {
+		fmt.Fprintf(gmancmd.Output(), "  %-12s %s\n", c[0], c[1])
+	}
+	fmt.Fprintf(gmancmd.Output(), "\nFlags, which go before the command:\n")
+	gmancmd.PrintDefaults()
+}
+
+// namespaceFlags are the flags of commands which read a namespace
+func namespaceFlags(fs *flag.FlagSet, all bool) {
+	fs.StringVar(namespace, "n", *namespace, "namespace")
+	if all {
+		fs.BoolVar(allNamespaces, "A", *allNamespaces, "all namespaces")
+	}
+}
+
+// pageFlags are the flags of commands which show a page
+func pageFlags(fs *flag.FlagSet) {
+	fs.BoolVar(tldr, "t", *tldr, "show tldr")
+	fs.BoolVar(render, "render", *render, "render markdown")
+	fs.StringVar(pager, "pager", *pager, "pager")
+	fs.BoolVar(openURL, "open", *openURL, "open url on get failure")
+}
+
+// outputFlag is the flag of commands which print a list
+func outputFlag(fs *flag.FlagSet) {
+	fs.StringVar(outputType, "o", *outputType, "output format. text, json, yaml")
+}
+
+var commands = []command{
+	{
+		name: "list",
+		usage: `  gman list [flags]              list the apps in the namespace
+  gman list -changed             list the apps which changed since you last viewed them
+`,
+		flags: func(fs *flag.FlagSet) {
+			namespaceFlags(fs, true)
+			fs.BoolVar(changed, "changed", *changed, "list apps which changed since you last viewed them")
+			outputFlag(fs)
+		},
+		args:   func(n int) bool { return n == 0 },
+		update: true,
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			if err := m.LoadApps(); err != nil {
+				log.Fatal(err)
+			}
+			if *changed {
+				changedCmd(ctx, m)
+				return
+			}
+			listCmd(m)
+		},
+	},
+	{
+		name: "show",
+		usage: `  gman show [flags] app          show the page of app, from the namespace or any other
+  gman show -diff app [rev1..rev2]
+                                 show what changed in app since you last viewed it, or between revisions
+`,
+		flags: func(fs *flag.FlagSet) {
+			namespaceFlags(fs, false)
+			pageFlags(fs)
+			fs.BoolVar(printDir, "dir", *printDir, "print man dir instead of showing contents")
+			fs.BoolVar(history, "history", *history, "list the commits which changed the app")
+			fs.StringVar(at, "at", *at, "show the app as of a commit or date")
+			fs.BoolVar(diff, "diff", *diff, "show what changed in the app since you last viewed it, or between revisions")
+			outputFlag(fs)
+		},
+		args:   func(n int) bool { return n == 1 || n == 2 && *diff },
+		update: true,
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			if err := m.LoadApps(); err != nil {
+				log.Fatal(err)
+			}
+			app := findApp(m, args[0])
+			if *diff {
+				rng := ""
+				if len(args) == 2 {
+					rng = args[1]
+				}
+				diffCmd(ctx, m, app, rng)
+				return
+			}
+			outputApp(ctx, m, app, printDir)
+		},
+	},
+	{
+		name: "search",
+		usage: `  gman search [flags] query      search the apps, showing the page if only one matches
+`,
+		flags: func(fs *flag.FlagSet) {
+			namespaceFlags(fs, true)
+			pageFlags(fs)
+			fs.BoolVar(printDir, "dir", *printDir, "print man dir instead of showing contents")
+			outputFlag(fs)
+		},
+		args:   func(n int) bool { return n > 0 },
+		update: true,
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			*search = strings.Join(args, " ")
+			if err := m.LoadApps(); err != nil {
+				log.Fatal(err)
+			}
+			searchCmd(ctx, m)
+		},
+	},
+	{
+		name: "releases",
+		usage: `  gman releases [flags]          list the releases
+  gman releases [flags] release  show the notes of release
+  gman releases -s query         search the releases, showing the notes if only one matches
+`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(search, "s", *search, "search")
+			fs.BoolVar(render, "render", *render, "render markdown")
+			fs.StringVar(pager, "pager", *pager, "pager")
+			outputFlag(fs)
+		},
+		args:   func(n int) bool { return n <= 1 },
+		update: true,
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			releasesCmd(ctx, m, args)
+		},
+	},
+	{
+		name: "namespaces",
+		usage: `  gman namespaces [flags]        list the namespaces
+`,
+		flags:  outputFlag,
+		args:   func(n int) bool { return n == 0 },
+		update: true,
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			if err := m.LoadApps(); err != nil {
+				log.Fatal(err)
+			}
+			namespacesCmd(m)
+		},
+	},
+	{
+		name: "serve",
+		usage: `  gman serve [flags]             run the web server, which updates the repo itself
+`,
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(webAddr, "web-addr", *webAddr, "web server address")
+			fs.StringVar(webDir, "web-dir", *webDir, "web server directory.")
+		},
+		args: func(n int) bool { return n == 0 },
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			webCmd(ctx, m)
+		},
+	},
+	{
+		name: "update",
+		usage: `  gman update                    update the repo now, as gman -update
+`,
+		flags: func(fs *flag.FlagSet) {},
+		args:  func(n int) bool { return n == 0 },
+		run: func(ctx context.Context, m *gman.Gman, args []string) {
+			*updateOnly = true
+			m.ForceUpdate = true
+			checkForUpdates(ctx, m)
+		},
+	},
+}
+
+// findCommand returns the command called name, or nil if there is none
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// runCommand parses the command's flags, loads the config with them
+// overriding gman's own flags, and runs it
+func runCommand(ctx context.Context, m *gman.Gman, c *command, args []string) {
+	fs := flag.NewFlagSet("gman "+c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of gman %s:\n%s", c.name, c.usage)
+		fs.PrintDefaults()
+	}
+	c.flags(fs)
+	fs.Parse(args)
+	if !c.args(len(fs.Args())) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	flags, err := flagConfig(gmancmd, fs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	loadConfig(m, flags)
+	m.WebDir = replaceTilde(m.WebDir)
+	if *allNamespaces {
+		m.CurrentNamespace = ""
+	}
+	if m.Repo == nil || m.Repo.URL == "" {
+		log.Fatal("no repo specified, run gman init to set one up")
+	}
+	if c.update {
+		checkForUpdates(ctx, m)
+	}
+	c.run(ctx, m, fs.Args())
+}
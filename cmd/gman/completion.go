@@ -0,0 +1,372 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+// completionShells are the shells gman completion has scripts for
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// The completion scripts pass the words typed so far to gman __complete,
+// so the same completions are offered in each shell. If there are none,
+// they fall back to completing file names.
+const bashCompletion = `# bash completion for gman, from gman completion bash
+_gman() {
+	local IFS=$'\n'
+	COMPREPLY=($(gman __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _gman gman
+`
+
+const zshCompletion = `#compdef gman
+# zsh completion for gman, from gman completion zsh
+_gman() {
+	local -a completions
+	completions=(${(f)"$(gman __complete "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+	if (( ${#completions} == 0 )); then
+		_files
+		return
+	fi
+	compadd -a completions
+}
+if [[ "${funcstack[1]}" == "_gman" ]]; then
+	_gman "$@"
+else
+	compdef _gman gman
+fi
+`
+
+const fishCompletion = `# fish completion for gman, from gman completion fish
+function __gman_complete
+	set -l completions (gman __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+	if test (count $completions) -eq 0
+		__fish_complete_path (commandline -ct)
+		return
+	end
+	printf '%s\n' $completions
+end
+complete -c gman -f -a '(__gman_complete)'
+`
+
+func completionUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman completion:
+  gman completion bash           print the bash completion script, eg. source <(gman completion bash)
+  gman completion zsh            print the zsh completion script, eg. source <(gman completion zsh)
+  gman completion fish           print the fish completion script, eg. gman completion fish | source
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// completionCmd runs gman completion, which prints the completion script
+// of a shell
+func completionCmd(args []string) {
+	fs := flag.NewFlagSet("gman completion", flag.ExitOnError)
+	fs.Usage = completionUsage(fs)
+	fs.Parse(args)
+	if len(fs.Args()) != 1 || !stringInSlice(fs.Arg(0), completionShells) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := writeCompletion(os.Stdout, fs.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeCompletion writes the completion script of shell
+func writeCompletion(w io.Writer, shell string) error {
+	script := map[string]string{
+		"bash": bashCompletion,
+		"zsh":  zshCompletion,
+		"fish": fishCompletion,
+	}[shell]
+	if script == "" {
+		return fmt.Errorf("no completion for %s, must be one of: %s", shell, strings.Join(completionShells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// completionFile returns where shell loads completion scripts from for
+// the user, and whether the directory has to be added to its path
+func completionFile(shell string) (string, bool, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", false, err
+	}
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		data = filepath.Join(home, ".local", "share")
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
+	}
+	switch shell {
+	case "bash":
+		return filepath.Join(data, "bash-completion", "completions", "gman"), false, nil
+	case "zsh":
+		// zsh has no directory for the user's completions by default
+		return filepath.Join(data, "zsh", "site-functions", "_gman"), true, nil
+	case "fish":
+		return filepath.Join(config, "fish", "completions", "gman.fish"), false, nil
+	}
+	return "", false, fmt.Errorf("no completion for %s, must be one of: %s", shell, strings.Join(completionShells, ", "))
+}
+
+// installCompletion writes the completion script of shell to file
+func installCompletion(file string, shell string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := writeCompletion(f, shell); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// completionValues are the values of flags which have a fixed set, and
+// completionValueFlags are the flags of commands outside of the commands
+// table which take a value
+var (
+	completionValues = map[string][]string{
+		"o":           {"text", "json", "yaml"},
+		"git-backend": {gman.GitBackendExec, gman.GitBackendGo},
+		"fail-on":     {gman.LintError, gman.LintWarning},
+	}
+	completionValueFlags = []string{"C", "file", "fail-on", "delay", "name"}
+)
+
+// takesValue reports whether the flag called name takes a value, as
+// opposed to a bool flag, in command c, or gman itself if c is nil
+func takesValue(c *command, name string) bool {
+	f := gmancmd.Lookup(name)
+	if c != nil {
+		f = commandFlags(c).Lookup(name)
+	} else if f == nil {
+		return stringInSlice(name, completionValueFlags)
+	}
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// commandFlags returns the flags of command c
+func commandFlags(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet("gman "+c.name, flag.ContinueOnError)
+	c.flags(fs)
+	return fs
+}
+
+// completeCmd runs gman __complete, which the completion scripts run with
+// the words typed after gman, the last being the word to complete. It
+// prints the completions one per line. Apps, namespaces and releases are
+// read from the local checkout, which is never updated, so completion
+// stays fast.
+func completeCmd(m *gman.Gman, args []string) {
+	// anything logged would be mixed into the command line
+	log.SetOutput(io.Discard)
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	for _, c := range complete(m, args[:len(args)-1], args[len(args)-1]) {
+		fmt.Println(c)
+	}
+}
+
+// complete returns the completions of cur, after the words before it
+func complete(m *gman.Gman, before []string, cur string) []string {
+	var cmd *command
+	var cmdName string
+	var args []string
+	releases := false
+	for i := 0; i < len(before); i++ {
+		w := before[i]
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			if cmdName == "" {
+				cmdName = w
+				cmd = findCommand(w)
+			} else {
+				args = append(args, w)
+			}
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if takesValue(cmd, name) && !hasValue {
+			if i+1 == len(before) {
+				// cur is the value of this flag
+				return filterPrefix(completeValue(m, name), cur)
+			}
+			i++
+			value = before[i]
+		} else if !hasValue {
+			value = "true"
+		}
+		if name == "r" {
+			releases = true
+		}
+		// flags such as -config, -profile and -n choose what is completed
+		if gmancmd.Lookup(name) != nil {
+			gmancmd.Set(name, value)
+		}
+	}
+	if strings.HasPrefix(cur, "-") {
+		if name, value, ok := strings.Cut(strings.TrimLeft(cur, "-"), "="); ok {
+			prefix := strings.TrimSuffix(cur, value)
+			var cs []string
+			for _, v := range filterPrefix(completeValue(m, name), value) {
+				cs = append(cs, prefix+v)
+			}
+			return cs
+		}
+		fs := gmancmd
+		if cmd != nil {
+			fs = commandFlags(cmd)
+		} else if cmdName != "" {
+			return nil
+		}
+		var cs []string
+		fs.VisitAll(func(f *flag.Flag) {
+			cs = append(cs, "-"+f.Name)
+		})
+		return filterPrefix(cs, cur)
+	}
+	var cs []string
+	switch {
+	case cmdName == "" && releases:
+		cs = completeReleases(m)
+	case cmdName == "":
+		for _, c := range commandSummaries {
+			cs = append(cs, c[0])
+		}
+		cs = append(cs, completeApps(m)...)
+	case len(args) > 0:
+		if cmdName == "new" && args[0] == "app" && len(args) == 1 {
+			for _, ns := range completeNamespaces(m) {
+				cs = append(cs, ns+"/")
+			}
+		}
+	case cmdName == "show":
+		cs = completeApps(m)
+	case cmdName == "releases":
+		cs = completeReleases(m)
+	case cmdName == "config":
+		cs = configCommands
+	case cmdName == "new":
+		cs = newCommands
+	case cmdName == "completion":
+		cs = completionShells
+	}
+	return filterPrefix(cs, cur)
+}
+
+// completeValue returns the values of the flag called name
+func completeValue(m *gman.Gman, name string) []string {
+	switch name {
+	case "n":
+		return completeNamespaces(m)
+	case "profile":
+		if err := loadCompletionConfig(m); err != nil {
+			return nil
+		}
+		return m.Profiles()
+	}
+	return completionValues[name]
+}
+
+// loadCompletionConfig loads the config with the flags typed so far
+func loadCompletionConfig(m *gman.Gman) error {
+	flags, err := flagConfig(gmancmd)
+	if err != nil {
+		return err
+	}
+	m.ConfigDir = replaceTilde(*dir)
+	if err := m.LoadConfig(flags); err != nil {
+		return err
+	}
+	if *allNamespaces {
+		m.CurrentNamespace = ""
+	}
+	return nil
+}
+
+// completeApps returns the names of the apps in the namespace
+func completeApps(m *gman.Gman) []string {
+	if err := loadCompletionConfig(m); err != nil {
+		return nil
+	}
+	if err := m.LoadApps(); err != nil {
+		return nil
+	}
+	var names []string
+	for _, app := range m.ListApps(m.CurrentNamespace) {
+		if !stringInSlice(app.Name, names) {
+			names = append(names, app.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeNamespaces returns the names of the namespaces
+func completeNamespaces(m *gman.Gman) []string {
+	if err := loadCompletionConfig(m); err != nil {
+		return nil
+	}
+	if err := m.LoadApps(); err != nil {
+		return nil
+	}
+	var names []string
+	for _, app := range m.ListApps("") {
+		if !stringInSlice(app.Namespace, names) {
+			names = append(names, app.Namespace)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completeReleases returns the names of the releases
+func completeReleases(m *gman.Gman) []string {
+	if err := loadCompletionConfig(m); err != nil {
+		return nil
+	}
+	if err := m.LoadReleases(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var names []string
+	for _, r := range m.ListReleases() {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// filterPrefix returns the completions which start with prefix, once
+// each, as an app may have the same name as a command
+func filterPrefix(cs []string, prefix string) []string {
+	var out []string
+	for _, c := range cs {
+		if strings.HasPrefix(c, prefix) && !stringInSlice(c, out) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"git.shdw.tech/shdw.tech/gman/internal/output"
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+// configCommands are the subcommands of gman config
+var configCommands = []string{"get", "set", "unset", "list", "validate", "schema"}
+
+func configUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman config:
+  gman config get key            print the effective value of key, eg. pager or repos.foo.branch
+  gman config set key value      set key in the config file. lists are comma separated
+  gman config unset key          remove key from the config file
+  gman config list               print the effective config, and where each value was set
+  gman config validate           check each config file, and the config as a whole
+  gman config schema             print the JSON Schema of the config file
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// configCmd runs a gman config subcommand. Unlike other commands, it
+// carries on if the config is invalid, so it can be fixed.
+func configCmd(m *gman.Gman, flags *gman.ConfigFile, args []string) {
+	fs := flag.NewFlagSet("gman config", flag.ExitOnError)
+	file := fs.String("file", m.UserConfigFile(), "config file to set or unset keys in")
+	out := fs.String("o", *outputType, "output format for list and validate. text, json, yaml")
+	fs.Usage = configUsage(fs)
+	cmd := args[0]
+	fs.Parse(args[1:])
+	args = fs.Args()
+	want := map[string]int{"get": 1, "set": 2, "unset": 1}[cmd]
+	if len(args) != want {
+		fs.Usage()
+		os.Exit(2)
+	}
+	switch cmd {
+	case "get":
+		if err := m.LoadConfig(flags); err != nil {
+			log.Fatal(err)
+		}
+		value, _, err := m.GetConfigValue(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(value)
+	case "set":
+		if err := gman.SetConfigValue(replaceTilde(*file), args[0], args[1]); err != nil {
+			log.Fatal(err)
+		}
+	case "unset":
+		if err := gman.UnsetConfigValue(replaceTilde(*file), args[0]); err != nil {
+			log.Fatal(err)
+		}
+	case "list":
+		if err := m.LoadConfig(flags); err != nil {
+			log.Fatal(err)
+		}
+		if err := output.PrintConfig(m.EffectiveConfig(), output.OutputType(*out)); err != nil {
+			log.Fatal(err)
+		}
+	case "validate":
+		errs, err := m.ValidateConfig(flags)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := output.PrintConfigErrors(errs, output.OutputType(*out)); err != nil {
+			log.Fatal(err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+	case "schema":
+		os.Stdout.Write(gman.ConfigSchema)
+	}
+}
+
+// loadConfig loads the config, exiting with each problem found if it is invalid
+func loadConfig(m *gman.Gman, flags *gman.ConfigFile) {
+	err := m.LoadConfig(flags)
+	var errs gman.ConfigErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			log.Error(e)
+		}
+		log.Fatal("invalid config, see gman config validate")
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
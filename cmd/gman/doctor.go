@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"git.shdw.tech/shdw.tech/gman/internal/output"
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+func doctorUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman doctor:
+  gman doctor                    check the programs gman needs, the config and credentials, and the local copy of the repo
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// doctorCmd runs gman doctor, which diagnoses the install and prints how
+// to fix each problem, and exits 1 if any are errors
+func doctorCmd(ctx context.Context, m *gman.Gman, flags *gman.ConfigFile, args []string) {
+	fs := flag.NewFlagSet("gman doctor", flag.ExitOnError)
+	out := fs.String("o", *outputType, "output format. text, json, yaml")
+	fs.Usage = doctorUsage(fs)
+	fs.Parse(args)
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	checks := m.Doctor(ctx, flags)
+	if err := output.PrintDoctor(checks, output.OutputType(*out)); err != nil {
+		log.Fatal(err)
+	}
+	if gman.DoctorFailed(checks) {
+		os.Exit(1)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"git.shdw.tech/shdw.tech/gman/internal/output"
@@ -27,20 +30,39 @@ var (
 	render         = gmancmd.Bool("render", true, "render markdown")
 	pager          = gmancmd.String("pager", "less", "pager")
 	repo           = gmancmd.String("repo", "", "git repo")
+	profile        = gmancmd.String("profile", "", "config profile to use")
 	branch         = gmancmd.String("branch", "main", "git branch")
 	updateInterval = gmancmd.String("interval", "24h", "update interval")
 	forceUpdate    = gmancmd.Bool("pull", false, "update repo now")
+	background     = gmancmd.Bool("background", false, "update repo in the background")
+	updateOnly     = gmancmd.Bool("update", false, "update repo now and exit")
+	ref            = gmancmd.String("ref", "", "pin the repo to a branch, tag, commit or tag version, eg. v2.x")
+	repoStatus     = gmancmd.Bool("status", false, "show the repo status")
+	gitBackend     = gmancmd.String("git-backend", "exec", "git backend. exec, go")
 	search         = gmancmd.String("s", "", "search")
 	version        = gmancmd.Bool("version", false, "show version")
+	manPage        = gmancmd.Bool("man", false, "print gman's own man page, eg. to install it")
 	printDir       = gmancmd.Bool("dir", false, "print man dir instead of showing contents")
+	history        = gmancmd.Bool("history", false, "list the commits which changed an app")
+	at             = gmancmd.String("at", "", "show an app as of a commit or date")
+	diff           = gmancmd.Bool("diff", false, "show what changed in an app since you last viewed it, or between revisions, eg. rev1..rev2")
+	changed        = gmancmd.Bool("changed", false, "list apps which changed since you last viewed them")
 	openURL        = gmancmd.Bool("open", false, "open url on get failure")
 	releases       = gmancmd.Bool("r", false, "show releases")
 	notifyReleases = gmancmd.Bool("notify", true, "notify on new releases")
+	digest         = gmancmd.Bool("digest", false, "show the apps changed by each update")
+	digestNS       = gmancmd.String("digest-ns", "", "comma separated namespaces to show in the update digest. default all")
+	lastChanges    = gmancmd.Bool("changes", false, "show the apps changed by the last update")
+	printConfig    = gmancmd.Bool("print-config", false, "print the effective config, and where each value was set")
 	web            = gmancmd.Bool("web", false, "run web server")
 	webAddr        = gmancmd.String("web-addr", ":8080", "web server address")
 	webDir         = gmancmd.String("web-dir", "~/.gman/web", "web server directory.")
 )
 
+// unlockRepo releases the shared lock on the checkout taken by
+// checkForUpdates, so it can be updated by other processes
+var unlockRepo = func() {}
+
 func init() {
 	ll, err := log.ParseLevel(os.Getenv("LOG_LEVEL"))
 	if err != nil {
@@ -50,7 +72,7 @@ func init() {
 }
 
 func replaceTilde(path string) string {
-	if path[:2] == "~/" {
+	if strings.HasPrefix(path, "~/") {
 		home, err := os.UserHomeDir()
 		if err != nil {
 			return path
@@ -61,15 +83,42 @@ func replaceTilde(path string) string {
 	return path
 }
 
-func outputApp(m *gman.Gman, app *gman.App, printDir *bool) {
+// printPage releases the checkout, as the page has been read, and shows
+// it, as it may be open in the pager for some time
+func printPage(ctx context.Context, render bool, pager string, content string) error {
+	unlockRepo()
+	return output.Print(ctx, render, pager, content)
+}
+
+func outputApp(ctx context.Context, m *gman.Gman, app *gman.App, printDir *bool) {
 	// if printDir is set, print the app dir and exit
 	if *printDir {
 		fmt.Print(app.Dir)
 		return
 	}
+	// if the user wants to see the history of the app, list it and exit
+	if *history {
+		commits, err := m.AppLog(ctx, app)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := output.PrintCommits(commits, output.OutputType(*outputType)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// if the user wants to see an earlier revision, show it and exit
+	if *at != "" {
+		outputAppAt(ctx, m, app, *at)
+		return
+	}
+	// remember the page as it is now, for -diff and -changed
+	if err := m.RecordView(ctx, app); err != nil {
+		log.WithError(err).Debug("unable to record view")
+	}
 	// if the user wants to see the tldr and one exists, show it and exit
 	if m.TLDR && app.ShortFile != nil {
-		tl, err := app.TLDR()
+		tl, err := app.TLDR(ctx)
 		if err != nil {
 			if strings.HasPrefix(err.Error(), "get error") {
 				// all we are going to return is the URL, so don't
@@ -79,14 +128,14 @@ func outputApp(m *gman.Gman, app *gman.App, printDir *bool) {
 				log.Fatal(err)
 			}
 		}
-		if err := output.Print(m.Render, m.Pager, tl); err != nil {
+		if err := printPage(ctx, m.Render, m.Pager, tl); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 	// if the user wants to see the readme and one exists, show it and exit
 	if app.ReadmeFile != nil {
-		rd, err := app.Readme()
+		rd, err := app.Readme(ctx)
 		if err != nil {
 			if strings.HasPrefix(err.Error(), "get error") {
 				// all we are going to return is the URL, so don't
@@ -96,22 +145,119 @@ func outputApp(m *gman.Gman, app *gman.App, printDir *bool) {
 				log.Fatal(err)
 			}
 		}
-		if err := output.Print(m.Render, m.Pager, rd); err != nil {
+		if err := printPage(ctx, m.Render, m.Pager, rd); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+}
+
+// outputAppAt shows the app's tldr or readme as of rev
+func outputAppAt(ctx context.Context, m *gman.Gman, app *gman.App, rev string) {
+	commit, err := m.ResolveAppRev(ctx, app, rev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var content string
+	if m.TLDR {
+		content, err = m.TLDRAt(ctx, app, commit)
+	}
+	// fall back to the readme if the app had no tldr at the time
+	if !m.TLDR || errors.Is(err, os.ErrNotExist) {
+		content, err = m.ReadmeAt(ctx, app, commit)
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "get error") {
+			// all we are going to return is the URL, so don't
+			// try to render it
+			m.Render = false
+		} else {
+			log.Fatal(err)
+		}
+	}
+	if err := printPage(ctx, m.Render, m.Pager, content); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// diffCmd shows what changed in the app between the revisions in rng,
+// eg. rev1..rev2, or since the user last viewed it if rng is empty
+func diffCmd(ctx context.Context, m *gman.Gman, app *gman.App, rng string) {
+	from, to, _ := strings.Cut(rng, "..")
+	if rng == "" {
+		view, err := m.LastView(app)
+		if err != nil {
 			log.Fatal(err)
 		}
+		if view == nil {
+			log.Fatalf("%s has not been viewed yet, pass a range to diff, eg. HEAD~1..", app.Name)
+		}
+		from = view.Commit
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+	from, err := m.ResolveAppRev(ctx, app, from)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to, err = m.ResolveAppRev(ctx, app, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	diffs, err := m.DiffApp(ctx, app, from, to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if rng == "" {
+		// the user has now seen the changes
+		if err := m.RecordView(ctx, app); err != nil {
+			log.WithError(err).Debug("unable to record view")
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Println("No changes")
 		return
 	}
+	var out []string
+	for _, d := range diffs {
+		out = append(out, d.Diff)
+	}
+	if err := printPage(ctx, false, m.Pager, strings.Join(out, "\n")); err != nil {
+		log.Fatal(err)
+	}
 }
 
-func releasesCmd(m *gman.Gman) {
+// findApp finds the app in the current namespace, falling back to all namespaces
+func findApp(m *gman.Gman, appName string) *gman.App {
+	app, err := m.GetApp(m.CurrentNamespace, appName)
+	if err != nil {
+		// if the app is not found in the current namespace, try all namespaces
+		if m.CurrentNamespace != "" {
+			app, err = m.GetApp("", appName)
+			if err != nil {
+				// if the app is not found, return an error
+				log.Fatal(err)
+			}
+		} else {
+			// if the app is not found, return an error
+			log.Fatal(err)
+		}
+	}
+	return app
+}
+
+// releasesCmd lists, searches or, given a release name in args, shows the
+// releases
+func releasesCmd(ctx context.Context, m *gman.Gman, args []string) {
 	// load current releases
 	if err := m.LoadReleases(); err != nil {
 		log.Fatal(err)
 	}
 	// if we have an arg, show the release
-	if len(gmancmd.Args()) == 1 {
+	if len(args) == 1 {
 		// get the release name from the args
-		releaseName := gmancmd.Args()[0]
+		releaseName := args[0]
 		// find the release
 		release, err := m.GetRelease(releaseName)
 		if err != nil {
@@ -119,7 +265,7 @@ func releasesCmd(m *gman.Gman) {
 			log.Fatal(err)
 		}
 		// get the release readme
-		rd, err := release.Readme()
+		rd, err := release.Readme(ctx)
 		if err != nil {
 			if strings.HasPrefix(err.Error(), "get error") {
 				m.Render = false
@@ -128,17 +274,17 @@ func releasesCmd(m *gman.Gman) {
 			}
 		}
 		// if the release is found, show it
-		if err := output.Print(m.Render, m.Pager, rd); err != nil {
+		if err := printPage(ctx, m.Render, m.Pager, rd); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 	// if we want to search, do it and exit
 	if *search != "" {
-		rs := m.SearchReleases(*search)
+		rs := m.SearchReleases(ctx, *search)
 		// if there is only one release, show it
 		if len(rs) == 1 {
-			rd, err := rs[0].Readme()
+			rd, err := rs[0].Readme(ctx)
 			if err != nil {
 				if strings.HasPrefix(err.Error(), "get error") {
 					m.Render = false
@@ -146,7 +292,7 @@ func releasesCmd(m *gman.Gman) {
 					log.Fatal(err)
 				}
 			}
-			if err := output.Print(m.Render, m.Pager, rd); err != nil {
+			if err := printPage(ctx, m.Render, m.Pager, rd); err != nil {
 				log.Fatal(err)
 			}
 			return
@@ -166,11 +312,11 @@ func releasesCmd(m *gman.Gman) {
 	}
 }
 
-func searchCmd(m *gman.Gman) {
-	apps := m.SearchApps(m.CurrentNamespace, *search)
+func searchCmd(ctx context.Context, m *gman.Gman) {
+	apps := m.SearchApps(ctx, m.CurrentNamespace, *search)
 	// if there is only one app, show it
 	if len(apps) == 1 {
-		outputApp(m, &apps[0], printDir)
+		outputApp(ctx, m, &apps[0], printDir)
 		return
 	}
 	// otherwise, show all apps and let the user choose
@@ -179,15 +325,196 @@ func searchCmd(m *gman.Gman) {
 	}
 }
 
-func checkForUpdates(m *gman.Gman) {
+// listCmd lists the apps in the current namespace
+func listCmd(m *gman.Gman) {
+	apps := m.ListApps(m.CurrentNamespace)
+	if err := output.PrintApps(m, apps, output.OutputType(*outputType)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// changedCmd lists the apps which changed since they were viewed
+func changedCmd(ctx context.Context, m *gman.Gman) {
+	apps, err := m.ChangedSinceViewed(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the apps may be in any namespace
+	m.CurrentNamespace = ""
+	if err := output.PrintApps(m, apps, output.OutputType(*outputType)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// namespacesCmd lists the namespaces
+func namespacesCmd(m *gman.Gman) {
+	// set the current namespace to "" so we get all namespaces
+	apps := m.ListApps("")
+	if err := output.PrintNamespaces(m, apps, output.OutputType(*outputType)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// announceReleases shows the readme of each new release
+func announceReleases(ctx context.Context, m *gman.Gman, rs []release.Release) {
+	for _, r := range rs {
+		rd, err := r.Readme(ctx)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "get error") {
+				m.Render = false
+			} else {
+				log.Fatal(err)
+			}
+		}
+		if err := output.Print(ctx, m.Render, "", rd); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func stringInSlice(s string, ss []string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// flagConfig returns the config set by the flags of gman and its command,
+// if any. Only the flags the user set are included, so they override the
+// config files and environment.
+func flagConfig(fss ...*flag.FlagSet) (*gman.ConfigFile, error) {
+	config := &gman.ConfigFile{}
+	var err error
+	for _, fs := range fss {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "interval":
+				d, perr := time.ParseDuration(*updateInterval)
+				if perr != nil {
+					err = fmt.Errorf("invalid update interval: %w", perr)
+				}
+				config.Interval = &d
+			case "background":
+				config.Background = background
+			case "git-backend":
+				config.GitBackend = gitBackend
+			case "n":
+				config.Namespace = namespace
+			case "open":
+				config.OpenOnGetFail = openURL
+			case "notify":
+				config.NotifyOnRelease = notifyReleases
+			case "digest":
+				config.Digest = digest
+			case "digest-ns":
+				config.DigestNS = strings.Split(*digestNS, ",")
+			case "pager":
+				config.Pager = pager
+			case "profile":
+				config.Profile = profile
+			case "repo":
+				config.Repo = repo
+			case "branch":
+				config.Branch = branch
+			case "ref":
+				config.Ref = ref
+			case "render":
+				config.Render = render
+			case "t":
+				config.TLDR = tldr
+			case "web":
+				config.Web = web
+			case "web-addr":
+				config.WebAddr = webAddr
+			case "web-dir":
+				config.WebDir = webDir
+			}
+		})
+	}
+	return config, err
+}
+
+// isApp reports whether name is an app in the local copy of the configured
+// repo. It is false if there is no config or local copy yet, eg. on first run.
+func isApp(m *gman.Gman, flags *gman.ConfigFile, name string) bool {
+	c := &gman.Gman{ConfigDir: m.ConfigDir}
+	if err := c.LoadConfig(flags); err != nil || c.Repo == nil || c.LocalDir == "" {
+		return false
+	}
+	if _, err := os.Stat(c.LocalDir); err != nil {
+		return false
+	}
+	if err := c.LoadApps(); err != nil {
+		return false
+	}
+	_, err := c.GetApp("", name)
+	return err == nil
+}
+
+// runsCommand reports whether gman's args run the command called name,
+// rather than show an app of the same name. The command is run if it is
+// given args or flags of its own, or there is no such app.
+func runsCommand(m *gman.Gman, flags *gman.ConfigFile, name string) bool {
+	if gmancmd.Arg(0) != name {
+		return false
+	}
+	if len(gmancmd.Args()) > 1 && !*diff {
+		return true
+	}
+	return !isApp(m, flags, name)
+}
+
+// backgroundArgs returns the flags for a background update of the same repo
+func backgroundArgs() []string {
+	args := []string{"-update", "-log", log.GetLevel().String()}
+	// only pass the flags which were set, so the config file still applies
+	gmancmd.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "config", "profile", "repo", "branch", "ref", "interval", "git-backend", "notify", "digest", "digest-ns":
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+func checkForUpdates(ctx context.Context, m *gman.Gman) {
 	// load current releases
 	if err := m.LoadReleases(); err != nil {
 		log.Fatal(err)
 	}
+	// announce any new releases found by a background update
+	if m.NotifyOnNewRelease && !*updateOnly {
+		pending, err := m.PendingReleases()
+		if err != nil {
+			log.WithError(err).Warn("unable to read new releases")
+		}
+		announceReleases(ctx, m, pending)
+	}
+	// if an update is due, start it in the background and carry on with
+	// the current checkout. the first clone is always done in the foreground.
+	if m.BackgroundUpdate && !m.ForceUpdate && m.UpdateDue() {
+		if _, err := os.Stat(m.LocalDir); err == nil {
+			err := m.StartBackgroundUpdate(backgroundArgs())
+			if err == nil {
+				unlockRepo = m.LockForRead(ctx)
+				// show what earlier background updates changed
+				announceDigest(ctx, m)
+				return
+			}
+			log.WithError(err).Warn("unable to start background update, updating now")
+		}
+	}
 	currentReleases := m.ListReleases()
 	// update the git repo
-	if err := m.GitUpdate(); err != nil {
-		log.Fatal(err)
+	if err := m.GitUpdate(ctx); err != nil {
+		var verr *gman.VerifyError
+		if !errors.As(err, &verr) || verr.Verified == "" {
+			log.Fatal(err)
+		}
+		// the checkout is still at the last verified commit, carry on with it
+		log.WithError(err).Error("update rejected")
 	}
 	// now, reload the releases
 	if err := m.LoadReleases(); err != nil {
@@ -198,32 +525,53 @@ func checkForUpdates(m *gman.Gman) {
 	// check for new releases
 	newReleases := release.NewReleases(currentReleases, rs)
 	// if we have new releases, and the user wants to be notified, do it
-	if newReleases != nil && len(newReleases) > 0 && m.NotifyOnNewRelease {
-		for _, r := range newReleases {
-			rd, err := r.Readme()
-			if err != nil {
-				if strings.HasPrefix(err.Error(), "get error") {
-					m.Render = false
-				} else {
-					log.Fatal(err)
-				}
-			}
-			if err := output.Print(m.Render, "", rd); err != nil {
+	if len(newReleases) > 0 && m.NotifyOnNewRelease {
+		if *updateOnly {
+			// there is nothing to show them with, so tell the user next time
+			if err := m.AddPendingReleases(newReleases); err != nil {
 				log.Fatal(err)
 			}
+			return
 		}
+		announceReleases(ctx, m, newReleases)
+	}
+	if !*updateOnly {
+		// hold the checkout until it has been read, so it isn't updated
+		// under us by another process
+		unlockRepo = m.LockForRead(ctx)
+		announceDigest(ctx, m)
 	}
 }
 
-func webCmd(m *gman.Gman) {
+// announceDigest shows the apps changed by any updates since it was last
+// shown. It goes to stderr, as it comes before the output of the command.
+func announceDigest(ctx context.Context, m *gman.Gman) {
+	if !m.Digest {
+		return
+	}
+	d, err := m.PendingDigest(ctx)
+	if err != nil {
+		log.WithError(err).Warn("unable to show update digest")
+		return
+	}
+	if d == nil || len(d.Apps) == 0 {
+		return
+	}
+	if err := output.AnnounceDigest(d); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func webCmd(ctx context.Context, m *gman.Gman) {
 	log.Info("starting web server. press ctrl-c to exit")
-	if err := m.Server(); err != nil {
+	if err := m.Server(ctx); err != nil {
 		log.Fatal(err)
 	}
 }
 
 func main() {
 	logLevel := gmancmd.String("log", log.GetLevel().String(), "log level")
+	gmancmd.Usage = usage
 	gmancmd.Parse(os.Args[1:])
 	ll, err := log.ParseLevel(*logLevel)
 	if err != nil {
@@ -235,53 +583,127 @@ func main() {
 		"fn":      "main",
 	})
 	l.Debug("starting")
+	// cancel any in-flight work on interrupt or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	if *version {
 		fmt.Printf("gman version %s", Version)
 		return
 	}
-	gman.OpenURLOnGetFailure = *openURL
-	release.OpenURLOnGetFailure = *openURL
-	gitDir := replaceTilde(*dir)
-	webDir := replaceTilde(*webDir)
-	m := &gman.Gman{
-		ConfigDir:          gitDir,
-		CurrentNamespace:   *namespace,
-		ForceUpdate:        *forceUpdate,
-		NotifyOnNewRelease: *notifyReleases,
-		Pager:              *pager,
-		Render:             *render,
-		TLDR:               *tldr,
-		WebMode:            *web,
-		WebAddr:            *webAddr,
-		WebDir:             webDir,
-	}
-	dur, err := time.ParseDuration(*updateInterval)
+	if *manPage {
+		writeManPage(os.Stdout)
+		return
+	}
+	flags, err := flagConfig(gmancmd)
 	if err != nil {
-		log.WithError(err).Fatal("invalid update interval")
+		log.Fatal(err)
+	}
+	m := &gman.Gman{
+		ConfigDir:   replaceTilde(*dir),
+		ForceUpdate: *forceUpdate || *updateOnly,
+	}
+	// gman __complete is run by the completion scripts, on every tab
+	if gmancmd.Arg(0) == "__complete" {
+		completeCmd(m, gmancmd.Args()[1:])
+		return
+	}
+	// gman completion <shell> prints a completion script, but an app may be called completion too
+	if gmancmd.Arg(0) == "completion" && len(gmancmd.Args()) > 1 && stringInSlice(gmancmd.Arg(1), completionShells) {
+		completionCmd(gmancmd.Args()[1:])
+		return
+	}
+	// gman config <command> manages the config, but an app may be called config too
+	if gmancmd.Arg(0) == "config" && len(gmancmd.Args()) > 1 && stringInSlice(gmancmd.Arg(1), configCommands) {
+		configCmd(m, flags, gmancmd.Args()[1:])
+		return
+	}
+	// gman new <kind> scaffolds a gman repo, but an app may be called new too
+	if gmancmd.Arg(0) == "new" && len(gmancmd.Args()) > 1 && stringInSlice(gmancmd.Arg(1), newCommands) {
+		newCmd(gmancmd.Args()[1:])
+		return
+	}
+	// gman lint checks a gman repo, which needn't be the configured one, but an app may be called lint too
+	if runsCommand(m, flags, "lint") {
+		lintCmd(ctx, m, flags, gmancmd.Args()[1:])
+		return
+	}
+	// gman links checks the links in a gman repo, but an app may be called links too
+	if runsCommand(m, flags, "links") {
+		linksCmd(ctx, m, flags, gmancmd.Args()[1:])
+		return
+	}
+	// gman doctor checks the config itself, so runs before it is loaded, but an app may be called doctor too
+	if runsCommand(m, flags, "doctor") {
+		doctorCmd(ctx, m, flags, gmancmd.Args()[1:])
+		return
+	}
+	// gman init sets up the config, so runs before it is loaded, but an app may be called init too
+	if runsCommand(m, flags, "init") {
+		initCmd(ctx, m, flags, gmancmd.Args()[1:])
+		return
+	}
+	// gman list, show and the other commands for reading the repo have
+	// their own flags, but an app may be called eg. list too, and existing
+	// scripts show it with gman list
+	if c := findCommand(gmancmd.Arg(0)); c != nil && runsCommand(m, flags, c.name) {
+		runCommand(ctx, m, c, gmancmd.Args()[1:])
+		return
+	}
+	loadConfig(m, flags)
+	m.WebDir = replaceTilde(m.WebDir)
+	// if we want to see the config, print it and exit
+	if *printConfig {
+		if err := output.PrintConfig(m.EffectiveConfig(), output.OutputType(*outputType)); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	m.UpdateInterval = dur
-	m.Repo = &gman.Repo{
-		URL:    *repo,
-		Branch: *branch,
+	if m.Repo == nil || m.Repo.URL == "" {
+		log.Fatal("no repo specified, run gman init to set one up")
 	}
-	m.LoadConfig()
-	m.LocalDir = path.Join(m.ConfigDir, m.RepoDir())
 	// if we want to run the web server, do it and exit
 	if m.WebMode {
-		webCmd(m)
+		webCmd(ctx, m)
 		return
 	}
 	if *allNamespaces {
 		m.CurrentNamespace = ""
 	}
-	if m.Repo == nil || m.Repo.URL == "" {
-		log.Fatal("no repo specified")
-	}
 	// check for updates and handle new releases
-	checkForUpdates(m)
+	checkForUpdates(ctx, m)
+	// if we only want to update, we're done
+	if *updateOnly {
+		return
+	}
+	// if we want to see the repo status, show it and exit
+	if *repoStatus {
+		s, err := m.RepoStatus(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := output.PrintRepoStatus(s, output.OutputType(*outputType)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	// if we want to see what the last update changed, show it and exit
+	if *lastChanges {
+		d, err := m.LastDigest(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if d == nil {
+			// nothing has changed since the repo was cloned
+			d = &gman.Digest{}
+		}
+		if err := output.PrintDigest(d, output.OutputType(*outputType)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	// if we want to operate on releases, do it and exit
 	if *releases {
-		releasesCmd(m)
+		releasesCmd(ctx, m, gmancmd.Args())
 		return
 	}
 	// first, load all apps into memory
@@ -291,48 +713,44 @@ func main() {
 	// if we only want to list the namespaces, do it and exit
 	if *showNamespaces {
 		l.Debug("listing namespaces")
-		// set the current namespace to "" so we get all namespaces
-		apps := m.ListApps("")
-		if err := output.PrintNamespaces(m, apps, output.OutputType(*outputType)); err != nil {
-			log.Fatal(err)
-		}
+		namespacesCmd(m)
+		return
+	}
+	// if we want to see which apps changed since they were viewed, list them and exit
+	if *changed {
+		changedCmd(ctx, m)
 		return
 	}
 	// if we want to search, do it and exit
 	if *search != "" {
 		l.Debug("searching apps")
-		searchCmd(m)
+		searchCmd(ctx, m)
 		return
 	}
 	// if we only want to list apps, do it and exit
 	if len(gmancmd.Args()) == 0 {
 		l.Debug("listing apps")
-		apps := m.ListApps(m.CurrentNamespace)
-		if err := output.PrintApps(m, apps, output.OutputType(*outputType)); err != nil {
-			log.Fatal(err)
+		listCmd(m)
+		return
+	}
+	// if we want to diff an app, do it and exit
+	if *diff {
+		if len(gmancmd.Args()) > 2 {
+			log.Fatal("usage: gman -diff app [rev1..rev2]")
 		}
+		app := findApp(m, gmancmd.Args()[0])
+		rng := ""
+		if len(gmancmd.Args()) == 2 {
+			rng = gmancmd.Args()[1]
+		}
+		diffCmd(ctx, m, app, rng)
 		return
 	}
 	// if there is only one arg, show the app
 	if len(gmancmd.Args()) == 1 {
-		// get the app name from the args
-		appName := gmancmd.Args()[0]
 		// find the app
-		app, err := m.GetApp(m.CurrentNamespace, appName)
-		if err != nil {
-			// if the app is not found in the current namespace, try all namespaces
-			if m.CurrentNamespace != "" {
-				app, err = m.GetApp("", appName)
-				if err != nil {
-					// if the app is not found, return an error
-					log.Fatal(err)
-				}
-			} else {
-				// if the app is not found, return an error
-				log.Fatal(err)
-			}
-		}
+		app := findApp(m, gmancmd.Args()[0])
 		// if the app is found, show it
-		outputApp(m, app, printDir)
+		outputApp(ctx, m, app, printDir)
 	}
 }
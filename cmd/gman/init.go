@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+func initUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman init:
+  gman init                       ask for the repo to use, check it can be fetched, and write the config
+  gman init -repo url -yes        set up the repo without asking
+  gman init -completion           also install the completion script of your shell
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// ask prints a question and returns the answer, or def if there is none
+func ask(r *bufio.Reader, question string, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := r.ReadString('\n')
+	if err == io.EOF && answer == "" {
+		// no more input, eg. stdin isn't a terminal
+		fmt.Println()
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+// confirm asks a yes or no question
+func confirm(r *bufio.Reader, question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	switch strings.ToLower(ask(r, question+" ("+hint+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// initCmd runs gman init, which sets up a new install: it asks for the
+// repo, checks it can be fetched, and writes it to the user's config file
+func initCmd(ctx context.Context, m *gman.Gman, flags *gman.ConfigFile, args []string) {
+	fs := flag.NewFlagSet("gman init", flag.ExitOnError)
+	repoURL := fs.String("repo", *repo, "url of the gman repo")
+	repoBranch := fs.String("branch", *branch, "branch of the gman repo")
+	name := fs.String("name", "", "name of the repo in the config. default the last element of the url")
+	man := fs.Bool("man", false, "install gman's man page without asking")
+	completion := fs.Bool("completion", false, "install the completion script of your shell without asking")
+	yes := fs.Bool("yes", false, "use the flags and defaults without asking")
+	fs.Usage = initUsage(fs)
+	fs.Parse(args)
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// the existing config chooses the git backend and credentials, and
+	// the current repo is the default
+	if err := m.LoadConfig(flags); err != nil {
+		log.WithError(err).Warn("ignoring invalid config, see gman config validate")
+	}
+	if *repoURL == "" && m.Repo != nil {
+		*repoURL = m.Repo.URL
+		*repoBranch = m.Repo.Branch
+	}
+	r := bufio.NewReader(os.Stdin)
+	if !*yes {
+		*repoURL = ask(r, "gman repo url", *repoURL)
+		*repoBranch = ask(r, "Branch", *repoBranch)
+	}
+	if *repoURL == "" {
+		log.Fatal("a repo url is required, eg. gman init -repo https://example.com/org/docs.git")
+	}
+	if *name == "" {
+		*name = gman.RepoName(*repoURL)
+		if !*yes {
+			*name = ask(r, "Name of the repo in the config", *name)
+		}
+	}
+	fmt.Printf("Checking %s can be fetched...\n", *repoURL)
+	if err := m.InitRepo(ctx, *name, &gman.Repo{URL: *repoURL, Branch: *repoBranch}); err != nil {
+		log.Error(err)
+		log.Fatal("check the url and branch, and your credentials for it, eg. in ~/.netrc or your ssh keys")
+	}
+	if err := m.LoadApps(); err != nil {
+		log.WithError(err).Warn("unable to load apps")
+	}
+	apps := m.ListApps("")
+	namespaces := make(map[string]bool)
+	for _, a := range apps {
+		namespaces[a.Namespace] = true
+	}
+	fmt.Printf("Found %d apps in %d namespaces\n", len(apps), len(namespaces))
+	fmt.Printf("Wrote %s\n", m.UserConfigFile())
+	if runtime.GOOS == "windows" {
+		return
+	}
+	file, err := manPageFile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *man || !*yes && confirm(r, fmt.Sprintf("Install gman's man page to %s?", file), false) {
+		if err := installManPage(file); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Installed %s\n", file)
+	}
+	initCompletion(r, *completion, *yes)
+}
+
+// initCompletion offers to install the completion script of the user's
+// shell, or installs it if install is set
+func initCompletion(r *bufio.Reader, install bool, yes bool) {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	if !stringInSlice(shell, completionShells) {
+		if install {
+			log.Warnf("no completion for shell %q, see gman completion -h", shell)
+		}
+		return
+	}
+	file, addToPath, err := completionFile(shell)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !install && (yes || !confirm(r, fmt.Sprintf("Install %s completion to %s?", shell, file), false)) {
+		return
+	}
+	if err := installCompletion(file, shell); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Installed %s\n", file)
+	if addToPath {
+		fmt.Printf("Add fpath+=(%s) to ~/.zshrc, before compinit, to load it\n", filepath.Dir(file))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"git.shdw.tech/shdw.tech/gman/internal/output"
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+func linksUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman links:
+  gman links [dir]               check the links in the gman repo dir is in, default the current directory
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// linksCmd runs gman links, which checks the links in a gman repo, and
+// exits 1 if any are broken
+func linksCmd(ctx context.Context, m *gman.Gman, flags *gman.ConfigFile, args []string) {
+	// the config provides the credentials and defaults for external
+	// links, so the repo can be checked without one, eg. in CI
+	if err := m.LoadConfig(flags); err != nil {
+		log.WithError(err).Debug("ignoring invalid config")
+	}
+	fs := flag.NewFlagSet("gman links", flag.ExitOnError)
+	out := fs.String("o", *outputType, "output format. text, json, yaml")
+	external := fs.Bool("external", m.LinkCheckExternal, "request external links too")
+	delay := fs.Duration("delay", m.LinkCheckDelay, "time between requests to the same host")
+	fs.Usage = linksUsage(fs)
+	fs.Parse(args)
+	if len(fs.Args()) > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if len(fs.Args()) == 1 {
+		dir = fs.Arg(0)
+	}
+	root, err := gman.FindRepoRoot(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m.LocalDir = root
+	m.LinkCheckDelay = *delay
+	report, err := m.CheckLinks(ctx, *external)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := output.PrintLinkReport(report, output.OutputType(*out)); err != nil {
+		log.Fatal(err)
+	}
+	if len(report.Broken) > 0 {
+		os.Exit(1)
+	}
+}
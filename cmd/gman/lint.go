@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"git.shdw.tech/shdw.tech/gman/internal/output"
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+func lintUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman lint:
+  gman lint [dir]                check the gman repo dir is in, default the current directory
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// lintCmd runs gman lint, which checks a gman repo for mistakes, and
+// exits 1 if any are found, eg. as a check before merging changes
+func lintCmd(ctx context.Context, m *gman.Gman, flags *gman.ConfigFile, args []string) {
+	fs := flag.NewFlagSet("gman lint", flag.ExitOnError)
+	out := fs.String("o", *outputType, "output format. text, json, yaml")
+	offline := fs.Bool("offline", false, "don't fetch pages which are only a url")
+	failOn := fs.String("fail-on", gman.LintError, "exit 1 if there are problems of this severity or worse. error, warning")
+	fs.Usage = lintUsage(fs)
+	fs.Parse(args)
+	if len(fs.Args()) > 1 || *failOn != gman.LintError && *failOn != gman.LintWarning {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if len(fs.Args()) == 1 {
+		dir = fs.Arg(0)
+	}
+	root, err := gman.FindRepoRoot(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the config only provides the credentials for fetching pages, so
+	// the repo can be linted without one, eg. in CI
+	if err := m.LoadConfig(flags); err != nil {
+		log.WithError(err).Debug("ignoring invalid config")
+	}
+	m.LocalDir = root
+	problems, err := m.Lint(ctx, *offline)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := output.PrintLint(problems, output.OutputType(*out)); err != nil {
+		log.Fatal(err)
+	}
+	if gman.LintFailed(problems, *failOn) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// roffEscape escapes text for a man page
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	// a line starting with a dot or quote would be read as a request
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// writeManPage writes gman's own man page, gman(1), built from its flags
+func writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH GMAN 1 \"\" \"gman %s\" \"User Commands\"\n", roffEscape(Version))
+	fmt.Fprint(w, `.SH NAME
+gman \- manage and read man pages in a git repo
+.SH SYNOPSIS
+.B gman
+[\fIflags\fR] [\fIapp\fR]
+.br
+.B gman
+[\fIflags\fR]
+\fBlist\fR|\fBnamespaces\fR|\fBserve\fR|\fBupdate\fR [\fIflags\fR]
+.br
+.B gman
+[\fIflags\fR]
+\fBshow\fR [\fIflags\fR] \fIapp\fR
+.br
+.B gman
+[\fIflags\fR]
+\fBsearch\fR [\fIflags\fR] \fIquery\fR
+.br
+.B gman
+[\fIflags\fR]
+\fBreleases\fR [\fIflags\fR] [\fIrelease\fR]
+.br
+.B gman init
+[\fIflags\fR]
+.br
+.B gman config
+\fIcommand\fR [\fIflags\fR] [\fIargs\fR]
+.br
+.B gman new
+\fBrepo\fR|\fBapp\fR|\fBrelease\fR [\fIflags\fR] \fIname\fR
+.br
+.B gman lint
+[\fIflags\fR] [\fIdir\fR]
+.br
+.B gman links
+[\fIflags\fR] [\fIdir\fR]
+.br
+.B gman doctor
+[\fIflags\fR]
+.br
+.B gman completion
+\fBbash\fR|\fBzsh\fR|\fBfish\fR
+.SH DESCRIPTION
+.B gman
+reads a git monorepo of documentation, and renders the page of an app to
+the terminal. Given a single argument, it shows the page of that app in the
+current namespace, like
+.BR man (1).
+.PP
+.BR list ,
+.BR show ,
+.BR search ,
+.BR releases ,
+.BR namespaces ,
+.B serve
+and
+.B update
+do the same as the flags below, with only the flags which apply to each,
+eg.
+.B gman list \-n ops
+is
+.BR "gman \-n ops" .
+Flags of gman itself go before the command. An app with the same name as a
+command is shown with
+.BR "gman show" .
+.PP
+.B gman init
+sets up the config, and checks the gman repo can be fetched.
+.B gman config
+gets, sets and validates the config.
+.B gman new
+creates a gman repo, or the page of an app or notes of a release in it.
+.B gman lint
+checks a gman repo for mistakes, such as broken links.
+.B gman links
+checks the links in a gman repo, including external links.
+.B gman doctor
+checks the install, the config and the local copy of the repo, and how to
+fix any problems.
+.B gman completion
+prints the completion script of a shell, which completes commands, flags,
+apps, namespaces, releases and profiles from the local copy of the repo.
+.SH OPTIONS
+`)
+	gmancmd.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, ".TP\n.B \\-%s", roffEscape(f.Name))
+		if name != "" {
+			fmt.Fprintf(w, " \\fI%s\\fR", roffEscape(name))
+		}
+		fmt.Fprintln(w)
+		switch {
+		case f.DefValue == "" || f.DefValue == "false":
+		case name == "string":
+			usage = fmt.Sprintf("%s (default %q)", usage, f.DefValue)
+		default:
+			usage = fmt.Sprintf("%s (default %s)", usage, f.DefValue)
+		}
+		fmt.Fprintln(w, roffEscape(usage))
+	})
+	fmt.Fprint(w, `.SH ENVIRONMENT
+.TP
+.B GMAN_*
+Each setting in the config file, eg.
+.B GMAN_INTERVAL
+or
+.BR GMAN_DIGEST_NAMESPACES .
+They override the config files, and are overridden by flags.
+.TP
+.B LOG_LEVEL
+The default log level.
+.SH FILES
+.TP
+.I ~/.gman/config.yaml
+The user's config.
+.TP
+.I /etc/gman/config.yaml
+The system config.
+.TP
+.I ~/.gman/src
+The local copies of the gman repos.
+.SH SEE ALSO
+.BR man (1),
+.BR git (1),
+.BR pandoc (1)
+`)
+}
+
+// manPageFile is where gman init installs gman's man page, in the user's
+// man path
+func manPageFile() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("man pages are not supported on %s", runtime.GOOS)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "man", "man1", "gman.1"), nil
+}
+
+// installManPage writes gman's man page to file
+func installManPage(file string) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	writeManPage(f)
+	return f.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	log "github.com/sirupsen/logrus"
+)
+
+// newCommands are the subcommands of gman new
+var newCommands = []string{"repo", "app", "release"}
+
+func newUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), `Usage of gman new:
+  gman new repo dir              create a new gman repo in dir
+  gman new app namespace/name    create the page of a new app, in the gman repo
+  gman new release version       create the notes of a new release, eg. v1.2.0, in the gman repo
+`)
+		fs.PrintDefaults()
+	}
+}
+
+// newCmd runs a gman new subcommand, which scaffolds a gman repo or its
+// contents from templates
+func newCmd(args []string) {
+	fs := flag.NewFlagSet("gman new", flag.ExitOnError)
+	root := fs.String("C", ".", "directory in the gman repo to create the app or release in")
+	fs.Usage = newUsage(fs)
+	cmd := args[0]
+	fs.Parse(args[1:])
+	args = fs.Args()
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	var files []string
+	var err error
+	switch cmd {
+	case "repo":
+		files, err = gman.ScaffoldRepo(args[0])
+	case "app":
+		ns, name, ok := strings.Cut(args[0], "/")
+		if !ok {
+			log.Fatalf("invalid app %q, must be namespace/name, eg. default/%s", args[0], args[0])
+		}
+		var dir string
+		if dir, err = gman.FindRepoRoot(*root); err == nil {
+			files, err = gman.ScaffoldApp(dir, ns, name)
+		}
+	case "release":
+		var dir string
+		if dir, err = gman.FindRepoRoot(*root); err == nil {
+			files, err = gman.ScaffoldRelease(dir, args[0])
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	for _, f := range files {
+		if rel, err := filepath.Rel(wd, f); err == nil {
+			f = rel
+		}
+		fmt.Printf("created %s\n", f)
+	}
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v3"
+)
+
+func printCommitsJSON(commits []gman.Commit) error {
+	jd, err := json.Marshal(commits)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printCommitsYAML(commits []gman.Commit) error {
+	yd, err := yaml.Marshal(commits)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printCommitsText(commits []gman.Commit) error {
+	if len(commits) == 0 {
+		println("No commits found")
+		return nil
+	}
+	tbl := table.New("Commit", "Date", "Author", "Subject")
+	for _, c := range commits {
+		tbl.AddRow(shortHash(c.Hash), c.Date.Format("2006-01-02 15:04:05"), c.Author, c.Subject)
+	}
+	tbl.Print()
+	return nil
+}
+
+func PrintCommits(commits []gman.Commit, output OutputType) error {
+	switch output {
+	case Text:
+		return printCommitsText(commits)
+	case JSON:
+		return printCommitsJSON(commits)
+	case YAML:
+		return printCommitsYAML(commits)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package output
+
+import (
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v3"
+)
+
+func printConfigJSON(values []gman.ConfigValue) error {
+	jd, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printConfigYAML(values []gman.ConfigValue) error {
+	yd, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printConfigText(values []gman.ConfigValue) error {
+	tbl := table.New("Key", "Value", "Source")
+	for _, v := range values {
+		tbl.AddRow(v.Key, v.Value, v.Source)
+	}
+	tbl.Print()
+	return nil
+}
+
+func PrintConfig(values []gman.ConfigValue, output OutputType) error {
+	switch output {
+	case Text:
+		return printConfigText(values)
+	case JSON:
+		return printConfigJSON(values)
+	case YAML:
+		return printConfigYAML(values)
+	}
+	return nil
+}
+
+func printConfigErrorsJSON(errs gman.ConfigErrors) error {
+	if errs == nil {
+		errs = gman.ConfigErrors{}
+	}
+	jd, err := json.Marshal(errs)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printConfigErrorsYAML(errs gman.ConfigErrors) error {
+	yd, err := yaml.Marshal(errs)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printConfigErrorsText(errs gman.ConfigErrors) error {
+	if len(errs) == 0 {
+		println("No problems found")
+		return nil
+	}
+	for _, e := range errs {
+		println(e.Error())
+	}
+	return nil
+}
+
+func PrintConfigErrors(errs gman.ConfigErrors, output OutputType) error {
+	switch output {
+	case Text:
+		return printConfigErrorsText(errs)
+	case JSON:
+		return printConfigErrorsJSON(errs)
+	case YAML:
+		return printConfigErrorsYAML(errs)
+	}
+	return nil
+}
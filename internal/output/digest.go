@@ -0,0 +1,73 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v3"
+)
+
+func printDigestJSON(d *gman.Digest) error {
+	jd, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printDigestYAML(d *gman.Digest) error {
+	yd, err := yaml.Marshal(d)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
+func printDigestText(w io.Writer, d *gman.Digest) error {
+	if len(d.Apps) == 0 {
+		fmt.Fprintln(w, "No apps changed")
+		return nil
+	}
+	fmt.Fprintf(w, "Apps changed in %s..%s\n\n", shortHash(d.From), shortHash(d.To))
+	tbl := table.New("Namespace", "App", "Change").WithWriter(w)
+	for _, a := range d.Apps {
+		tbl.AddRow(a.Namespace, a.Name, a.Change)
+	}
+	tbl.Print()
+	return nil
+}
+
+// AnnounceDigest prints the digest as text to stderr, so it can be shown
+// alongside the output of any command without mixing into it
+func AnnounceDigest(d *gman.Digest) error {
+	if err := printDigestText(os.Stderr, d); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+func PrintDigest(d *gman.Digest, output OutputType) error {
+	switch output {
+	case Text:
+		return printDigestText(os.Stdout, d)
+	case JSON:
+		return printDigestJSON(d)
+	case YAML:
+		return printDigestYAML(d)
+	}
+	return nil
+}
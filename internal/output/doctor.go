@@ -0,0 +1,67 @@
+package output
+
+import (
+	"fmt"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"gopkg.in/yaml.v3"
+)
+
+func printDoctorJSON(checks []gman.Check) error {
+	jd, err := json.Marshal(checks)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printDoctorYAML(checks []gman.Check) error {
+	yd, err := yaml.Marshal(checks)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printDoctorText(checks []gman.Check) error {
+	group := ""
+	problems := 0
+	for _, c := range checks {
+		if c.Group != group {
+			if group != "" {
+				println()
+			}
+			group = c.Group
+			println(group)
+		}
+		println(fmt.Sprintf("  %-8s %s: %s", c.Status, c.Name, c.Message))
+		if c.Fix != "" {
+			println(fmt.Sprintf("  %-8s fix: %s", "", c.Fix))
+		}
+		if c.Status == gman.CheckWarning || c.Status == gman.CheckError {
+			problems++
+		}
+	}
+	println()
+	if problems == 0 {
+		println("No problems found")
+	} else {
+		println(fmt.Sprintf("%d problems found", problems))
+	}
+	return nil
+}
+
+func PrintDoctor(checks []gman.Check, output OutputType) error {
+	switch output {
+	case Text:
+		return printDoctorText(checks)
+	case JSON:
+		return printDoctorJSON(checks)
+	case YAML:
+		return printDoctorYAML(checks)
+	}
+	return nil
+}
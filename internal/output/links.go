@@ -0,0 +1,51 @@
+package output
+
+import (
+	"fmt"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"gopkg.in/yaml.v3"
+)
+
+func printLinkReportJSON(report *gman.LinkReport) error {
+	jd, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printLinkReportYAML(report *gman.LinkReport) error {
+	yd, err := yaml.Marshal(report)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printLinkReportText(report *gman.LinkReport) error {
+	for _, b := range report.Broken {
+		println(fmt.Sprintf("%s:%d: %s: %s", b.File, b.Line, b.Target, b.Reason))
+	}
+	checked := fmt.Sprintf("Checked %d links in %d pages", report.Links, report.Pages)
+	if report.External > 0 {
+		checked += fmt.Sprintf(", including %d external links", report.External)
+	}
+	println(fmt.Sprintf("%s, %d broken", checked, len(report.Broken)))
+	return nil
+}
+
+func PrintLinkReport(report *gman.LinkReport, output OutputType) error {
+	switch output {
+	case Text:
+		return printLinkReportText(report)
+	case JSON:
+		return printLinkReportJSON(report)
+	case YAML:
+		return printLinkReportYAML(report)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"gopkg.in/yaml.v3"
+)
+
+func printLintJSON(problems []gman.LintProblem) error {
+	if problems == nil {
+		problems = []gman.LintProblem{}
+	}
+	jd, err := json.Marshal(problems)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printLintYAML(problems []gman.LintProblem) error {
+	yd, err := yaml.Marshal(problems)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printLintText(problems []gman.LintProblem) error {
+	if len(problems) == 0 {
+		println("No problems found")
+		return nil
+	}
+	for _, p := range problems {
+		println(p.String())
+	}
+	return nil
+}
+
+func PrintLint(problems []gman.LintProblem, output OutputType) error {
+	switch output {
+	case Text:
+		return printLintText(problems)
+	case JSON:
+		return printLintJSON(problems)
+	case YAML:
+		return printLintYAML(problems)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package output
 
 import (
 	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"strings"
@@ -25,7 +26,7 @@ func PagerPrint(pager string, data string) error {
 	return cmd.Run()
 }
 
-func RenderPandoc(data string) (string, error) {
+func RenderPandoc(ctx context.Context, data string) (string, error) {
 	// pipe data to:
 	// pandoc -s -f markdown -t man | groff -T utf8 -man
 	// then print that
@@ -37,7 +38,7 @@ func RenderPandoc(data string) (string, error) {
 		"-t",
 		"man",
 	}
-	cmd := exec.Command(cmds[0], cmds[1:]...)
+	cmd := exec.CommandContext(ctx, cmds[0], cmds[1:]...)
 	cmd.Stdin = strings.NewReader(data)
 	if log.GetLevel() == log.DebugLevel {
 		cmd.Stderr = os.Stderr
@@ -52,7 +53,7 @@ func RenderPandoc(data string) (string, error) {
 		"utf8",
 		"-man",
 	}
-	cmd = exec.Command(cmds[0], cmds[1:]...)
+	cmd = exec.CommandContext(ctx, cmds[0], cmds[1:]...)
 	cmd.Stdin = strings.NewReader(string(out))
 	outData := bytes.Buffer{}
 	cmd.Stdout = &outData
@@ -66,10 +67,10 @@ func RenderPandoc(data string) (string, error) {
 	return outData.String(), nil
 }
 
-func Print(render bool, pager string, data string) error {
+func Print(ctx context.Context, render bool, pager string, data string) error {
 	if render {
 		var err error
-		data, err = RenderPandoc(data)
+		data, err = RenderPandoc(ctx, data)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,64 @@
+package output
+
+import (
+	"git.shdw.tech/shdw.tech/gman/pkg/gman"
+	"github.com/go-jose/go-jose/v3/json"
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v3"
+)
+
+func printRepoStatusJSON(s *gman.RepoStatus) error {
+	jd, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	println(string(jd))
+	return nil
+}
+
+func printRepoStatusYAML(s *gman.RepoStatus) error {
+	yd, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	println(string(yd))
+	return nil
+}
+
+func printRepoStatusText(s *gman.RepoStatus) error {
+	tbl := table.New("Field", "Value")
+	tbl.AddRow("Repo", s.URL)
+	tbl.AddRow("Dir", s.Dir)
+	tbl.AddRow("Branch", s.Branch)
+	if s.Pin != "" {
+		tbl.AddRow("Pinned", s.Pin)
+	}
+	tbl.AddRow("Ref", s.Ref)
+	tbl.AddRow("Commit", s.Commit)
+	if !s.LastUpdated.IsZero() {
+		tbl.AddRow("Last Updated", s.LastUpdated.Format("2006-01-02 15:04:05"))
+	}
+	tbl.Print()
+	if len(s.Submodules) == 0 {
+		return nil
+	}
+	println()
+	tbl = table.New("Submodule", "Status", "Error")
+	for _, sub := range s.Submodules {
+		tbl.AddRow(sub.Path, sub.Status, sub.Error)
+	}
+	tbl.Print()
+	return nil
+}
+
+func PrintRepoStatus(s *gman.RepoStatus, output OutputType) error {
+	switch output {
+	case Text:
+		return printRepoStatusText(s)
+	case JSON:
+		return printRepoStatusJSON(s)
+	case YAML:
+		return printRepoStatusYAML(s)
+	}
+	return nil
+}
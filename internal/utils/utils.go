@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -58,24 +59,33 @@ func StringSearch(s string, search string) bool {
 		return true
 	}
 	// try regex
-	rx := regexp.MustCompile(search)
+	rx, err := regexp.Compile(search)
+	if err != nil {
+		return false
+	}
 	if rx.MatchString(s) {
 		return true
 	}
 	return false
 }
 
+// NetrcFile is the netrc file credentials are read from. If it is empty, ~/.netrc is used
+var NetrcFile string
+
 func AuthForDomain(domain string) (login *string, password *string) {
 	// check if there is a ~/.netrc file
 	// if so, check if there is a machine entry for the domain
 	// if so, return the token
 	// if not, return nil
 	// if there is no ~/.netrc file, return nil
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return nil, nil
+	netrcPath := NetrcFile
+	if netrcPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		netrcPath = path.Join(home, ".netrc")
 	}
-	netrcPath := path.Join(home, ".netrc")
 	if _, err := os.Stat(netrcPath); os.IsNotExist(err) {
 		return nil, nil
 	}
@@ -86,7 +96,7 @@ func AuthForDomain(domain string) (login *string, password *string) {
 	return &m.Login, &m.Password
 }
 
-func getRemoteImageContent(u string) (string, error) {
+func getRemoteImageContent(ctx context.Context, u string) (string, error) {
 	l := log.WithField("fn", "getRemoteImageContent")
 	l.Debug("getting remote image content")
 	u = strings.TrimSpace(u)
@@ -96,7 +106,10 @@ func getRemoteImageContent(u string) (string, error) {
 	}
 	c := &http.Client{}
 	l.WithField("url", u).Debug("getting remote")
-	req, err := http.NewRequest("GET", u, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
 	// check if we have a token for the domain
 	_, token := AuthForDomain(ud.Host)
 	if token != nil {
@@ -141,7 +154,7 @@ func fileIsImage(f string) bool {
 	return false
 }
 
-func rewriteRelativePaths(u string, data string, embedImages bool) string {
+func rewriteRelativePaths(ctx context.Context, u string, data string, embedImages bool) string {
 	l := log.WithField("fn", "rewriteRelativePaths")
 	l.Debug("rewriting relative paths")
 	rx := regexp.MustCompile(`\]\((\.\.\/)*([^\)]+)\)`)
@@ -162,7 +175,7 @@ func rewriteRelativePaths(u string, data string, embedImages bool) string {
 				"new_path": u + "/" + p,
 			}).Debug("rewriting relative path")
 			if fileIsImage(p) && embedImages {
-				ed, err := getRemoteImageContent(u + "/" + p)
+				ed, err := getRemoteImageContent(ctx, u+"/"+p)
 				if err != nil {
 					l.WithError(err).Error("error getting remote image content")
 					continue
@@ -188,7 +201,7 @@ func rewriteRelativePaths(u string, data string, embedImages bool) string {
 		if !IsOnlyUrl(p) {
 			// rewrite the path
 			if fileIsImage(p) && embedImages {
-				ed, err := getRemoteImageContent(u + "/" + p)
+				ed, err := getRemoteImageContent(ctx, u+"/"+p)
 				if err != nil {
 					l.WithError(err).Error("error getting remote image content")
 					continue
@@ -203,7 +216,7 @@ func rewriteRelativePaths(u string, data string, embedImages bool) string {
 	return data
 }
 
-func GetRemote(u string, embedImages bool) (string, error) {
+func GetRemote(ctx context.Context, u string, embedImages bool) (string, error) {
 	l := log.WithField("fn", "GetRemote")
 	l.Debug("getting remote")
 	u = strings.TrimSpace(u)
@@ -218,7 +231,10 @@ func GetRemote(u string, embedImages bool) (string, error) {
 		},
 	}
 	l.WithField("url", u).Debug("getting remote")
-	req, err := http.NewRequest("GET", u, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
 	// check if we have a token for the domain
 	_, token := AuthForDomain(ud.Host)
 	if token != nil {
@@ -247,7 +263,7 @@ func GetRemote(u string, embedImages bool) (string, error) {
 	// pop the last element off the path, and use that as the base url
 	u = strings.Join(strings.Split(u, "/")[:len(strings.Split(u, "/"))-1], "/")
 	// rewrite relative paths
-	data := rewriteRelativePaths(u, string(bd), embedImages)
+	data := rewriteRelativePaths(ctx, u, string(bd), embedImages)
 	return data, err
 }
 
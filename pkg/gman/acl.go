@@ -0,0 +1,132 @@
+package gman
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// ACLFile is the path of the access control file, relative to the root of the gman repo
+const ACLFile = ".gman/acl.yaml"
+
+// NamespaceACL lists the users and groups allowed to view a namespace.
+// A user of "*" allows any authenticated user.
+type NamespaceACL struct {
+	Users  []string `json:"users" yaml:"users"`
+	Groups []string `json:"groups" yaml:"groups"`
+}
+
+// ACL restricts namespaces to certain users and groups in server mode.
+// Namespaces which are not listed are visible to everyone.
+type ACL struct {
+	// Groups maps group names to their members, for users who
+	// authenticate without a groups header, eg. with basic auth
+	Groups     map[string][]string      `json:"groups" yaml:"groups"`
+	Namespaces map[string]*NamespaceACL `json:"namespaces" yaml:"namespaces"`
+}
+
+func (g *Gman) readACL() (*ACL, error) {
+	l := log.WithField("fn", "readACL")
+	f := filepath.Join(g.LocalDir, ACLFile)
+	b, err := os.ReadFile(f)
+	if os.IsNotExist(err) {
+		l.Debug("no acl file")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	acl := &ACL{}
+	if err := yaml.Unmarshal(b, acl); err != nil {
+		l.WithError(err).Error("error parsing acl file")
+		return nil, err
+	}
+	l.WithField("namespaces", len(acl.Namespaces)).Debug("acl loaded")
+	return acl, nil
+}
+
+// Restricted reports whether the namespace is limited to certain users
+func (a *ACL) Restricted(namespace string) bool {
+	if a == nil {
+		return false
+	}
+	_, ok := a.Namespaces[namespace]
+	return ok
+}
+
+func (a *ACL) groups(u *User) []string {
+	groups := append([]string(nil), u.Groups...)
+	for group, members := range a.Groups {
+		if stringInSlice(u.Name, members) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Allowed reports whether the user may view the namespace. A nil user,
+// ie. an unauthenticated request, may only view unrestricted namespaces.
+func (a *ACL) Allowed(u *User, namespace string) bool {
+	if !a.Restricted(namespace) {
+		return true
+	}
+	if u == nil {
+		return false
+	}
+	ns := a.Namespaces[namespace]
+	if ns == nil {
+		return false
+	}
+	if stringInSlice("*", ns.Users) || stringInSlice(u.Name, ns.Users) {
+		return true
+	}
+	for _, group := range a.groups(u) {
+		if stringInSlice(group, ns.Groups) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathNamespace returns the namespace of a file or directory in the repo,
+// eg. ns for docs/ns/app/README.md, or "" if it isn't in a namespace
+func pathNamespace(p string) string {
+	parts := strings.Split(path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "/")), "/")
+	if len(parts) < 2 || parts[0] != "docs" {
+		return ""
+	}
+	return parts[1]
+}
+
+// AllowedPath reports whether the user may view the file or directory at
+// p, relative to the root of the repo. Paths outside the namespaces are allowed.
+func (a *ACL) AllowedPath(u *User, p string) bool {
+	ns := pathNamespace(p)
+	return ns == "" || a.Allowed(u, ns)
+}
+
+// FilterApps returns only the apps the user may view
+func (a *ACL) FilterApps(u *User, apps []App) []App {
+	if a == nil {
+		return apps
+	}
+	var allowed []App
+	for _, app := range apps {
+		if a.Allowed(u, app.Namespace) {
+			allowed = append(allowed, app)
+		}
+	}
+	return allowed
+}
+
+func stringInSlice(s string, ss []string) bool {
+	for _, s2 := range ss {
+		if s == s2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package gman
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the access controlled pages and API are served under this prefix,
+// alongside the static docusaurus site
+const apiPrefix = "/_gman/"
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>gman</title></head>
+<body>
+<h1>gman</h1>
+{{range $ns, $apps := .}}<h2>{{$ns}}</h2>
+<ul>
+{{range $apps}}<li><a href="/_gman/docs/{{.Namespace}}/{{.Name}}">{{.Name}}</a>{{if .ShortFile}} (<a href="/_gman/docs/{{.Namespace}}/{{.Name}}?tldr=true">tldr</a>){{end}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+func requestUser(r *http.Request) *User {
+	u, _ := UserFromContext(r.Context())
+	return u
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("error writing response")
+	}
+}
+
+// apiApp is an app as returned by the API. It has the app's page rather
+// than its files, which are paths on the server.
+type apiApp struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// URL is the app's page, see pageHandler
+	URL string `json:"url"`
+	// TLDRURL is the app's tldr page, if it has one
+	TLDRURL string `json:"tldrUrl,omitempty"`
+}
+
+func newAPIApps(apps []App) []apiApp {
+	out := make([]apiApp, 0, len(apps))
+	for _, app := range apps {
+		a := apiApp{
+			Namespace: app.Namespace,
+			Name:      app.Name,
+			URL:       apiPrefix + "docs/" + app.Namespace + "/" + app.Name,
+		}
+		if app.ShortFile != nil {
+			a.TLDRURL = a.URL + "?tldr=true"
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// visibleApps returns the apps in the namespace that the user of the request may view
+func (g *Gman) visibleApps(r *http.Request, namespace string) []App {
+	return g.Catalog().ACL.FilterApps(requestUser(r), g.ListApps(namespace))
+}
+
+// apiAppsHandler lists the apps the user may view
+func (g *Gman) apiAppsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, newAPIApps(g.visibleApps(r, r.URL.Query().Get("n"))))
+}
+
+// apiSearchHandler searches the apps the user may view
+func (g *Gman) apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "missing search query", http.StatusBadRequest)
+		return
+	}
+	acl := g.Catalog().ACL
+	apps := acl.FilterApps(requestUser(r), g.SearchApps(r.Context(), r.URL.Query().Get("n"), q))
+	writeJSON(w, newAPIApps(apps))
+}
+
+// indexHandler lists the apps the user may view, including those in
+// restricted namespaces which are not part of the static site
+func (g *Gman) indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != apiPrefix {
+		http.NotFound(w, r)
+		return
+	}
+	byNamespace := make(map[string][]App)
+	for _, app := range g.visibleApps(r, "") {
+		byNamespace[app.Namespace] = append(byNamespace[app.Namespace], app)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, byNamespace); err != nil {
+		log.WithError(err).Error("error writing index")
+	}
+}
+
+// pageHandler renders a single app page to HTML, if the user may view it
+func (g *Gman) pageHandler(w http.ResponseWriter, r *http.Request) {
+	l := log.WithField("fn", "pageHandler")
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, apiPrefix+"docs/"), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	// respond the same way whether the app is hidden or missing,
+	// so restricted apps can't be discovered
+	if !g.Catalog().ACL.Allowed(requestUser(r), parts[0]) {
+		http.NotFound(w, r)
+		return
+	}
+	app, err := g.GetApp(parts[0], parts[1])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var md string
+	if r.URL.Query().Get("tldr") == "true" && app.ShortFile != nil {
+		md, err = app.TLDR(r.Context())
+	} else {
+		md, err = app.Readme(r.Context())
+	}
+	if err != nil {
+		l.WithError(err).Error("error reading app")
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	cmd := exec.CommandContext(r.Context(), "pandoc", "-s", "-f", "markdown", "-t", "html", "--metadata", "title="+app.Name)
+	cmd.Stdin = strings.NewReader(md)
+	out, err := cmd.Output()
+	if err != nil {
+		l.WithError(err).Error("error rendering app")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(out)
+}
+
+// restrictedPath reports whether a static site path belongs to a
+// namespace the user may not view. Restricted namespaces are excluded
+// from the static build, this guards against a stale build.
+func (g *Gman) restrictedPath(r *http.Request) bool {
+	return !g.Catalog().ACL.AllowedPath(requestUser(r), r.URL.Path)
+}
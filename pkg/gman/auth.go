@@ -0,0 +1,228 @@
+package gman
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is the identity of an authenticated web request
+type User struct {
+	Name   string   `json:"name" yaml:"name"`
+	Groups []string `json:"groups" yaml:"groups"`
+}
+
+type userContextKey struct{}
+
+// UserFromContext returns the authenticated user for a web request, if any
+func UserFromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(userContextKey{}).(*User)
+	return u, ok
+}
+
+// htpasswd authenticates users against an htpasswd file, reloading
+// the file whenever it changes. bcrypt and SHA1 hashes are supported.
+type htpasswd struct {
+	file string
+
+	mu    sync.Mutex
+	mod   time.Time
+	users map[string]string
+}
+
+func newHtpasswd(file string) (*htpasswd, error) {
+	h := &htpasswd{file: file}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *htpasswd) reload() error {
+	l := log.WithField("fn", "htpasswd.reload")
+	stat, err := os.Stat(h.file)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.users != nil && stat.ModTime().Equal(h.mod) {
+		return nil
+	}
+	f, err := os.Open(h.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			l.WithField("user", user).Warn("unsupported htpasswd hash, use bcrypt (htpasswd -B)")
+			continue
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	l.WithField("users", len(users)).Debug("loaded htpasswd file")
+	h.users = users
+	h.mod = stat.ModTime()
+	return nil
+}
+
+func (h *htpasswd) Authenticate(user, pass string) bool {
+	if err := h.reload(); err != nil {
+		log.WithField("fn", "htpasswd.Authenticate").WithError(err).Error("error reloading htpasswd file")
+	}
+	h.mu.Lock()
+	hash, ok := h.users[user]
+	h.mu.Unlock()
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(pass))
+		enc := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(enc), []byte(strings.TrimPrefix(hash, "{SHA}"))) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+}
+
+// webAuth authenticates web requests, either from a header set by a
+// trusted reverse proxy or with HTTP basic auth
+type webAuth struct {
+	htpasswd          *htpasswd
+	proxyUserHeader   string
+	proxyGroupsHeader string
+	trustedProxies    []*net.IPNet
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+// defaultTrustedProxies are trusted to set the proxy headers if no
+// trusted proxies are configured, so a proxy on the same host works
+// without exposing the headers to every client
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1"}
+
+// newWebAuth returns the configured authenticator, or nil if the
+// server has no authentication configured
+func (g *Gman) newWebAuth() (*webAuth, error) {
+	if g.WebHtpasswd == "" && g.WebProxyUserHeader == "" {
+		return nil, nil
+	}
+	a := &webAuth{
+		proxyUserHeader:   g.WebProxyUserHeader,
+		proxyGroupsHeader: g.WebProxyGroupsHeader,
+	}
+	if g.WebHtpasswd != "" {
+		h, err := newHtpasswd(g.WebHtpasswd)
+		if err != nil {
+			return nil, fmt.Errorf("htpasswd: %w", err)
+		}
+		a.htpasswd = h
+	}
+	proxies := g.WebTrustedProxies
+	if a.proxyUserHeader != "" && len(proxies) == 0 {
+		log.WithField("fn", "newWebAuth").Warn("webTrustedProxies not set, only trusting proxy headers from localhost")
+		proxies = defaultTrustedProxies
+	}
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if strings.Contains(p, ":") {
+				p += "/128"
+			} else {
+				p += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy: %w", err)
+		}
+		a.trustedProxies = append(a.trustedProxies, n)
+	}
+	return a, nil
+}
+
+// trusted reports whether the request came from a trusted proxy
+func (a *webAuth) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *webAuth) authenticate(r *http.Request) (*User, error) {
+	if a.proxyUserHeader != "" && a.trusted(r) {
+		if name := r.Header.Get(a.proxyUserHeader); name != "" {
+			u := &User{Name: name}
+			if a.proxyGroupsHeader != "" {
+				for _, grp := range strings.Split(r.Header.Get(a.proxyGroupsHeader), ",") {
+					if grp = strings.TrimSpace(grp); grp != "" {
+						u.Groups = append(u.Groups, grp)
+					}
+				}
+			}
+			return u, nil
+		}
+	}
+	if a.htpasswd != nil {
+		name, pass, ok := r.BasicAuth()
+		if ok && a.htpasswd.Authenticate(name, pass) {
+			return &User{Name: name}, nil
+		}
+	}
+	return nil, errUnauthorized
+}
+
+func (a *webAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := a.authenticate(r)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"fn":     "webAuth",
+				"remote": r.RemoteAddr,
+				"path":   r.URL.Path,
+			}).Debug("unauthorized request")
+			if a.htpasswd != nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="gman", charset="UTF-8"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userContextKey{}, u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,148 @@
+package gman
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWebAuthTrusted(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		want    bool
+	}{
+		{"default loopback v4", nil, "127.0.0.1:1234", true},
+		{"default loopback v6", nil, "[::1]:1234", true},
+		{"default remote", nil, "10.1.2.3:1234", false},
+		{"cidr match", []string{"10.0.0.0/8"}, "10.1.2.3:1234", true},
+		{"cidr no match", []string{"10.0.0.0/8"}, "192.168.1.1:1234", false},
+		{"configured excludes loopback", []string{"10.0.0.0/8"}, "127.0.0.1:1234", false},
+		{"single ip", []string{"192.168.1.1"}, "192.168.1.1:1234", true},
+		{"single ipv6", []string{"fd00::1"}, "[fd00::1]:1234", true},
+		{"no port", []string{"192.168.1.1"}, "192.168.1.1", true},
+		{"invalid remote", []string{"10.0.0.0/8"}, "not-an-ip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Gman{WebProxyUserHeader: "X-Forwarded-User", WebTrustedProxies: tt.proxies}
+			a, err := g.newWebAuth()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if got := a.trusted(r); got != tt.want {
+				t.Errorf("trusted(%q) = %v, want %v", tt.remote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWebAuth(t *testing.T) {
+	g := &Gman{}
+	if a, err := g.newWebAuth(); a != nil || err != nil {
+		t.Errorf("newWebAuth() with no auth = %v, %v, want nil, nil", a, err)
+	}
+	g = &Gman{WebProxyUserHeader: "X-Forwarded-User", WebTrustedProxies: []string{"nope/99"}}
+	if _, err := g.newWebAuth(); err == nil {
+		t.Error("newWebAuth() with an invalid trusted proxy succeeded")
+	}
+}
+
+func TestWebAuthAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(file, []byte("alice:"+string(hash)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	g := &Gman{
+		WebHtpasswd:          file,
+		WebProxyUserHeader:   "X-Forwarded-User",
+		WebProxyGroupsHeader: "X-Forwarded-Groups",
+		WebTrustedProxies:    []string{"10.0.0.1"},
+	}
+	a, err := g.newWebAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		user    string
+		pass    string
+		want    *User
+	}{
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-User": "bob", "X-Forwarded-Groups": "dev, ops,,"},
+			want:    &User{Name: "bob", Groups: []string{"dev", "ops"}},
+		},
+		{
+			name:    "untrusted proxy",
+			remote:  "10.0.0.2:1234",
+			headers: map[string]string{"X-Forwarded-User": "bob", "X-Forwarded-Groups": "admin"},
+		},
+		{
+			name:    "untrusted proxy falls back to basic auth",
+			remote:  "10.0.0.2:1234",
+			headers: map[string]string{"X-Forwarded-User": "bob"},
+			user:    "alice",
+			pass:    "secret",
+			want:    &User{Name: "alice"},
+		},
+		{
+			name:   "basic auth",
+			remote: "192.168.1.1:1234",
+			user:   "alice",
+			pass:   "secret",
+			want:   &User{Name: "alice"},
+		},
+		{
+			name:   "wrong password",
+			remote: "192.168.1.1:1234",
+			user:   "alice",
+			pass:   "wrong",
+		},
+		{
+			name:   "no credentials",
+			remote: "192.168.1.1:1234",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if tt.user != "" {
+				r.SetBasicAuth(tt.user, tt.pass)
+			}
+			got, err := a.authenticate(r)
+			if tt.want == nil {
+				if err != errUnauthorized {
+					t.Errorf("authenticate() = %v, %v, want unauthorized", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package gman
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"git.shdw.tech/shdw.tech/gman/pkg/release"
+	log "github.com/sirupsen/logrus"
+)
+
+// pendingReleasesFile records the new releases found by a background
+// update, until they are announced, relative to the root of the checkout
+const pendingReleasesFile = ".git/gman-releases.json"
+
+// UpdateDue reports whether the next call to GitUpdate will clone or pull the repo
+func (g *Gman) UpdateDue() bool {
+	if _, err := os.Stat(g.LocalDir); err != nil {
+		return true
+	}
+	return g.updateDue() != ""
+}
+
+// UpdateLogFile is the log of the last background update
+func (g *Gman) UpdateLogFile() string {
+	return g.LocalDir + ".log"
+}
+
+// StartBackgroundUpdate runs gman with args in a detached process, which
+// carries on after this one exits. Its output is written to UpdateLogFile.
+// Only one background update runs at a time: the log file stays locked
+// until the process exits, and no other is started meanwhile.
+func (g *Gman) StartBackgroundUpdate(args []string) error {
+	l := log.WithField("fn", "StartBackgroundUpdate")
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(g.UpdateLogFile()), 0755); err != nil {
+		return err
+	}
+	// don't truncate the log until we know no update is writing to it
+	lf, err := os.OpenFile(g.UpdateLogFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	// the process inherits the locked file as its output, so the lock is
+	// held until it exits
+	if err := tryLockFile(lf, true); errors.Is(err, errLocked) {
+		l.Debug("background update already running")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := lf.Truncate(0); err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = lf
+	cmd.Stderr = lf
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	l.WithField("pid", cmd.Process.Pid).Debug("started background update")
+	return cmd.Process.Release()
+}
+
+func (g *Gman) readPendingReleases() ([]string, error) {
+	b, err := os.ReadFile(filepath.Join(g.LocalDir, pendingReleasesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// AddPendingReleases records new releases to be announced later, by PendingReleases
+func (g *Gman) AddPendingReleases(rs []release.Release) error {
+	if len(rs) == 0 {
+		return nil
+	}
+	names, err := g.readPendingReleases()
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		if !stringInSlice(r.Name, names) {
+			names = append(names, r.Name)
+		}
+	}
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.LocalDir, pendingReleasesFile), b, 0644)
+}
+
+// PendingReleases returns the releases recorded by AddPendingReleases,
+// and forgets them so they are only announced once. Releases must be loaded.
+func (g *Gman) PendingReleases() ([]release.Release, error) {
+	names, err := g.readPendingReleases()
+	if err != nil || names == nil {
+		return nil, err
+	}
+	var rs []release.Release
+	for _, name := range names {
+		// the release may have been removed since
+		if r, err := g.GetRelease(name); err == nil {
+			rs = append(rs, *r)
+		}
+	}
+	if err := os.Remove(filepath.Join(g.LocalDir, pendingReleasesFile)); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
@@ -3,10 +3,18 @@ package gman
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
 	"git.shdw.tech/shdw.tech/gman/pkg/release"
 	log "github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
@@ -15,65 +23,424 @@ import (
 type Repo struct {
 	URL    string `json:"repo" yaml:"url"`
 	Branch string `json:"branch" yaml:"branch"`
+	// Depth limits the clone to the given number of commits. 0 clones the full history
+	Depth int `json:"depth,omitempty" yaml:"depth,omitempty"`
+	// Sparse only checks out the paths gman reads, see SparsePaths
+	Sparse bool `json:"sparse,omitempty" yaml:"sparse,omitempty"`
+	// Namespaces further limits a sparse checkout to the given namespaces
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Ref pins the checkout to a branch, tag or commit instead of following Branch
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	// Tag pins the checkout to a tag. A version constraint, eg. v2.x or
+	// v2.3.x, follows the latest matching release tag
+	Tag string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// Commit pins the checkout to a commit
+	Commit string `json:"commit,omitempty" yaml:"commit,omitempty"`
+	// Verify requires updates to be signed by a trusted key
+	Verify *Verify `json:"verify,omitempty" yaml:"verify,omitempty"`
+}
+
+// SparsePaths returns the directories checked out when Sparse is set
+func (r *Repo) SparsePaths() []string {
+	paths := []string{"releases", ".gman"}
+	if len(r.Namespaces) == 0 {
+		return append(paths, "docs")
+	}
+	for _, ns := range r.Namespaces {
+		paths = append(paths, path.Join("docs", ns))
+	}
+	return paths
 }
 
 type ConfigFile struct {
-	Interval        *time.Duration   `json:"interval" yaml:"interval"`
-	Namespace       *string          `json:"namespace" yaml:"namespace"`
-	OpenOnGetFail   *bool            `json:"open" yaml:"open"`
-	NotifyOnRelease *bool            `json:"notify" yaml:"notify"`
-	Pager           *string          `json:"pager" yaml:"pager"`
-	Repo            *string          `json:"repo" yaml:"repo"`
-	Render          *bool            `json:"render" yaml:"render"`
-	TLDR            *bool            `json:"tldr" yaml:"tldr"`
-	Repos           map[string]*Repo `json:"repos" yaml:"repos"`
-	Web             *bool            `json:"web" yaml:"web"`
-	WebAddr         *string          `json:"webAddr" yaml:"webAddr"`
-	WebDir          *string          `json:"webDir" yaml:"webDir"`
-}
-
-func (g *Gman) LoadConfig() error {
+	Interval        *time.Duration `json:"interval" yaml:"interval"`
+	Background      *bool          `json:"background" yaml:"background"`
+	GitBackend      *string        `json:"gitBackend" yaml:"gitBackend"`
+	Namespace       *string        `json:"namespace" yaml:"namespace"`
+	OpenOnGetFail   *bool          `json:"open" yaml:"open"`
+	NotifyOnRelease *bool          `json:"notify" yaml:"notify"`
+	Digest          *bool          `json:"digest" yaml:"digest"`
+	DigestNS        []string       `json:"digestNamespaces" yaml:"digestNamespaces"`
+	Pager           *string        `json:"pager" yaml:"pager"`
+	// Repo names an entry in Repos, or is the URL of a repo
+	Repo *string `json:"repo" yaml:"repo"`
+	// Branch and Ref override the branch and pin of the selected repo
+	Branch         *string          `json:"branch" yaml:"branch"`
+	Ref            *string          `json:"ref" yaml:"ref"`
+	Render         *bool            `json:"render" yaml:"render"`
+	TLDR           *bool            `json:"tldr" yaml:"tldr"`
+	Repos          map[string]*Repo `json:"repos" yaml:"repos"`
+	Web            *bool            `json:"web" yaml:"web"`
+	WebAddr        *string          `json:"webAddr" yaml:"webAddr"`
+	WebDir         *string          `json:"webDir" yaml:"webDir"`
+	WebTLSCert     *string          `json:"webTLSCert" yaml:"webTLSCert"`
+	WebTLSKey      *string          `json:"webTLSKey" yaml:"webTLSKey"`
+	WebHtpasswd    *string          `json:"webHtpasswd" yaml:"webHtpasswd"`
+	WebProxyUser   *string          `json:"webProxyUserHeader" yaml:"webProxyUserHeader"`
+	WebProxyGroups *string          `json:"webProxyGroupsHeader" yaml:"webProxyGroupsHeader"`
+	WebProxies     []string         `json:"webTrustedProxies" yaml:"webTrustedProxies"`
+	// LinkCheckInterval schedules CheckLinks in server mode
+	LinkCheckInterval *time.Duration `json:"linkCheckInterval" yaml:"linkCheckInterval"`
+	LinkCheckExternal *bool          `json:"linkCheckExternal" yaml:"linkCheckExternal"`
+	LinkCheckDelay    *time.Duration `json:"linkCheckDelay" yaml:"linkCheckDelay"`
+	// Auth selects the credentials used to fetch repos and pages
+	Auth *Auth `json:"auth" yaml:"auth"`
+	// Profile selects one of Profiles
+	Profile *string `json:"profile" yaml:"profile"`
+	// Profiles are named sets of settings, such as the repos, namespace and
+	// auth for a client. The selected profile overrides the config files.
+	Profiles map[string]*ConfigFile `json:"profiles" yaml:"profiles"`
+}
+
+// Config layers, from lowest to highest precedence
+const (
+	ConfigDefault = "default"
+	ConfigSystem  = "system"
+	ConfigRepo    = "repo"
+	ConfigUser    = "user"
+	ConfigProfile = "profile"
+	ConfigEnv     = "env"
+	ConfigFlag    = "flag"
+)
+
+// SystemConfigFile is the config shared by all users of the machine
+var SystemConfigFile = "/etc/gman/config.yaml"
+
+// RepoConfigFile is the config provided by the gman repo, relative to its root
+const RepoConfigFile = ".gman/config.yaml"
+
+// repoConfigKeys are the only settings the gman repo's config may set.
+// The others choose where content comes from or what runs on the user's
+// machine, so are left to the user.
+var repoConfigKeys = []string{
+	"interval",
+	"background",
+	"namespace",
+	"notify",
+	"digest",
+	"digestNamespaces",
+	"render",
+	"tldr",
+}
+
+// ConfigValue is a setting in the effective config
+type ConfigValue struct {
+	Key   string `json:"key" yaml:"key"`
+	Value string `json:"value" yaml:"value"`
+	// Source is the layer the value was set in, and where it was read from
+	Source string `json:"source" yaml:"source"`
+}
+
+// configLayer is one source of config, see LoadConfig
+type configLayer struct {
+	name string
+	// file the layer was read from, if any
+	file string
+	// profile is the name of the profile the layer holds, if any
+	profile string
+	config  *ConfigFile
+}
+
+// source describes where the layer set key
+func (c *configLayer) source(key string) string {
+	switch {
+	case c.name == ConfigEnv:
+		return ConfigEnv + " " + envName(key)
+	case c.name == ConfigProfile:
+		return ConfigProfile + " " + c.profile
+	case c.file != "":
+		return c.name + " " + c.file
+	}
+	return c.name
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// DefaultConfig returns the built-in defaults, which every other layer overrides
+func DefaultConfig() *ConfigFile {
+	return &ConfigFile{
+		Interval:        ptr(24 * time.Hour),
+		Background:      ptr(false),
+		GitBackend:      ptr(GitBackendExec),
+		Namespace:       ptr("default"),
+		OpenOnGetFail:   ptr(false),
+		NotifyOnRelease: ptr(true),
+		Digest:          ptr(false),
+		Pager:           ptr("less"),
+		Render:          ptr(true),
+		TLDR:            ptr(false),
+		Web:             ptr(false),
+		WebAddr:         ptr(":8080"),
+		WebDir:          ptr("~/.gman/web"),
+		// off unless scheduled, as external links may be rate limited
+		LinkCheckInterval: ptr(time.Duration(0)),
+		LinkCheckExternal: ptr(false),
+		LinkCheckDelay:    ptr(time.Second),
+	}
+}
+
+// configKey returns the name of a ConfigFile field in the config file
+func configKey(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	return key
+}
+
+// envName returns the environment variable which sets key, eg. webAddr is GMAN_WEB_ADDR
+func envName(key string) string {
+	var b strings.Builder
+	b.WriteString("GMAN_")
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := rune(key[i-1])
+			// split before a word, keeping acronyms together, eg. webTLSCert
+			next := i+1 < len(key) && unicode.IsLower(rune(key[i+1]))
+			if unicode.IsLower(prev) || next && unicode.IsUpper(prev) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// readConfigFile reads a config file, returning nil if it doesn't exist.
+// If strict is set, any problem found by ValidateConfigFile is returned
+// as ConfigErrors, otherwise unknown keys are ignored.
+func readConfigFile(file string, strict bool) (*ConfigFile, error) {
+	b, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if errs := ValidateConfigFile(file, b); len(errs) > 0 {
+		if strict {
+			return nil, errs
+		}
+		log.WithFields(log.Fields{
+			"fn":   "readConfigFile",
+			"file": file,
+		}).WithError(errs).Debug("invalid config")
+	}
+	config := &ConfigFile{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		// try json
+		if err := json.Unmarshal(b, config); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", file, err)
+		}
+	}
+	return config, nil
+}
+
+// envConfig reads the config set by GMAN_* environment variables, eg.
+// GMAN_PAGER. Lists are comma separated. Repos can't be set.
+func envConfig() (*ConfigFile, error) {
+	config := &ConfigFile{}
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envName(configKey(t.Field(i)))
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Interface().(type) {
+		case *string:
+			f.Set(reflect.ValueOf(&s))
+		case *bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			f.Set(reflect.ValueOf(&b))
+		case *time.Duration:
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			f.Set(reflect.ValueOf(&d))
+		case []string:
+			f.Set(reflect.ValueOf(strings.Split(s, ",")))
+		}
+	}
+	return config, nil
+}
+
+// restrictRepoConfig removes the settings the gman repo may not set, see repoConfigKeys
+func restrictRepoConfig(config *ConfigFile) {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := configKey(t.Field(i))
+		if v.Field(i).IsNil() || stringInSlice(key, repoConfigKeys) {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"fn":  "restrictRepoConfig",
+			"key": key,
+		}).Debug("ignoring setting in the repo config, it can only be set by the user")
+		v.Field(i).Set(reflect.Zero(v.Field(i).Type()))
+	}
+}
+
+// mergeConfig sets each value set in the layer on config, and records
+// where it came from in sources. Repos are merged by name.
+func mergeConfig(config *ConfigFile, layer *configLayer, sources map[string]string) {
+	dst := reflect.ValueOf(config).Elem()
+	src := reflect.ValueOf(layer.config).Elem()
+	t := src.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := src.Field(i)
+		if f.IsNil() {
+			continue
+		}
+		key := configKey(t.Field(i))
+		if f.Kind() == reflect.Map {
+			if dst.Field(i).IsNil() {
+				dst.Field(i).Set(reflect.MakeMap(f.Type()))
+			}
+			for _, k := range f.MapKeys() {
+				dst.Field(i).SetMapIndex(k, f.MapIndex(k))
+				sources[key+"."+k.String()] = layer.source(key)
+			}
+			continue
+		}
+		dst.Field(i).Set(f)
+		sources[key] = layer.source(key)
+	}
+}
+
+// LoadConfig loads the config from each layer, and applies it. From lowest
+// to highest precedence, the layers are the built-in defaults, the
+// SystemConfigFile, the gman repo's RepoConfigFile, the user's config.yaml
+// in the ConfigDir, the selected profile, GMAN_* environment variables,
+// and then flags, which holds only the flags the user set.
+func (g *Gman) LoadConfig(flags *ConfigFile) error {
 	l := log.WithField("fn", "LoadConfig")
 	l.Debug("loading config")
 	if g.ConfigDir == "" {
 		l.Error("config dir not set")
 		return errors.New("config dir not set")
 	}
-	// ensure config dir exists
-	_, err := os.Stat(g.ConfigDir)
-	if os.IsNotExist(err) {
-		l.Error("config dir does not exist")
-		return errors.New("config dir does not exist")
-	}
-	// load config file
-	configFile := filepath.Join(g.ConfigDir, "config.yaml")
-	// if file doesn't exist, return nil
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		l.Debug("config file does not exist")
-		return nil
-	}
-	// read the file
-	b, err := os.ReadFile(configFile)
+	// a missing config dir is a new install, with only the other layers
+	var err error
+	layers := []*configLayer{{name: ConfigDefault, config: DefaultConfig()}}
+	for _, layer := range []*configLayer{
+		{name: ConfigSystem, file: SystemConfigFile},
+		{name: ConfigUser, file: g.UserConfigFile()},
+	} {
+		if layer.config, err = readConfigFile(layer.file, true); err != nil {
+			l.WithError(err).Error("error reading config file")
+			return err
+		}
+		if layer.config == nil {
+			l.WithField("file", layer.file).Debug("config file does not exist")
+			continue
+		}
+		layers = append(layers, layer)
+	}
+	env, err := envConfig()
 	if err != nil {
-		l.WithError(err).Error("error reading config file")
 		return err
 	}
-	// parse the file
-	var config ConfigFile
-	err = yaml.Unmarshal(b, &config)
+	layers = append(layers, &configLayer{name: ConfigEnv, config: env})
+	if flags != nil {
+		layers = append(layers, &configLayer{name: ConfigFlag, config: flags})
+	}
+	config, sources := g.mergeLayers(layers)
+	// the profile can be selected by any layer, and sits above the files
+	profile, err := selectProfile(config)
 	if err != nil {
-		// try json
-		err = json.Unmarshal(b, &config)
+		return layerError(layers, "profile", err.Error())
+	}
+	if profile != nil {
+		i := len(layers) - 1
+		for layers[i].name == ConfigEnv || layers[i].name == ConfigFlag {
+			i--
+		}
+		layers = append(layers[:i+1], append([]*configLayer{profile}, layers[i+1:]...)...)
+		config, sources = g.mergeLayers(layers)
+	}
+	if err := checkRepoRef(config, layers); err != nil {
+		return err
+	}
+	g.applyConfig(config)
+	// the repo's config sits between the system and user config, so it
+	// can only be read once the other layers have chosen the repo
+	if g.LocalDir != "" {
+		f := filepath.Join(g.LocalDir, RepoConfigFile)
+		// the user can't fix the repo's config, so don't fail on it
+		rc, err := readConfigFile(f, false)
 		if err != nil {
-			l.WithError(err).Error("error parsing config file")
+			l.WithError(err).Error("error reading repo config file")
 			return err
 		}
+		if rc != nil {
+			restrictRepoConfig(rc)
+			i := 1
+			if layers[i].name == ConfigSystem {
+				i++
+			}
+			layers = append(layers[:i], append([]*configLayer{{name: ConfigRepo, file: f, config: rc}}, layers[i:]...)...)
+			config, sources = g.mergeLayers(layers)
+			g.applyConfig(config)
+		}
+	}
+	g.config = config
+	g.configSources = sources
+	l.Debug("config loaded")
+	return nil
+}
+
+// UserConfigFile is the user's config file, in the ConfigDir
+func (g *Gman) UserConfigFile() string {
+	return filepath.Join(g.ConfigDir, "config.yaml")
+}
+
+// mergeLayers merges the layers, lowest precedence first
+func (g *Gman) mergeLayers(layers []*configLayer) (*ConfigFile, map[string]string) {
+	config := &ConfigFile{}
+	sources := make(map[string]string)
+	for _, layer := range layers {
+		mergeConfig(config, layer, sources)
+	}
+	return config, sources
+}
+
+// applyConfig sets the merged config on g
+func (g *Gman) applyConfig(config *ConfigFile) {
+	g.Repo = nil
+	g.LocalDir = ""
+	if config.Repo != nil && *config.Repo != "" {
+		if r := config.Repos[*config.Repo]; r != nil {
+			// copy the repo, so overrides don't change the config
+			repo := *r
+			g.Repo = &repo
+		} else {
+			g.Repo = &Repo{URL: *config.Repo, Branch: "main"}
+		}
+		if config.Branch != nil {
+			g.Repo.Branch = *config.Branch
+		}
+		if config.Ref != nil {
+			// the ref replaces any pin from the repo
+			g.Repo.Ref = *config.Ref
+			g.Repo.Tag = ""
+			g.Repo.Commit = ""
+		}
+		g.LocalDir = filepath.Join(g.ConfigDir, g.RepoDir())
 	}
-	if g.Repo != nil && g.Repo.URL != "" && config.Repos[g.Repo.URL] != nil {
-		g.Repo = config.Repos[g.Repo.URL]
+	g.Profile = ""
+	if config.Profile != nil {
+		g.Profile = *config.Profile
 	}
-	if g.Repo == nil || g.Repo.URL == "" && config.Repo != nil && config.Repos[*config.Repo] != nil {
-		g.Repo = config.Repos[*config.Repo]
+	g.Auth = config.Auth.resolve(g.ConfigDir)
+	utils.NetrcFile = ""
+	if g.Auth != nil {
+		utils.NetrcFile = g.Auth.Netrc
 	}
 	if config.OpenOnGetFail != nil {
 		OpenURLOnGetFailure = *config.OpenOnGetFail
@@ -82,9 +449,21 @@ func (g *Gman) LoadConfig() error {
 	if config.NotifyOnRelease != nil {
 		g.NotifyOnNewRelease = *config.NotifyOnRelease
 	}
+	if config.Digest != nil {
+		g.Digest = *config.Digest
+	}
+	if config.DigestNS != nil {
+		g.DigestNamespaces = config.DigestNS
+	}
 	if config.Interval != nil {
 		g.UpdateInterval = *config.Interval
 	}
+	if config.Background != nil {
+		g.BackgroundUpdate = *config.Background
+	}
+	if config.GitBackend != nil {
+		g.GitBackend = *config.GitBackend
+	}
 	if config.Render != nil {
 		g.Render = *config.Render
 	}
@@ -106,6 +485,103 @@ func (g *Gman) LoadConfig() error {
 	if config.WebDir != nil {
 		g.WebDir = *config.WebDir
 	}
-	l.Debug("config loaded")
-	return nil
+	if config.WebTLSCert != nil {
+		g.WebTLSCert = *config.WebTLSCert
+	}
+	if config.WebTLSKey != nil {
+		g.WebTLSKey = *config.WebTLSKey
+	}
+	if config.WebHtpasswd != nil {
+		g.WebHtpasswd = *config.WebHtpasswd
+	}
+	if config.WebProxyUser != nil {
+		g.WebProxyUserHeader = *config.WebProxyUser
+	}
+	if config.WebProxyGroups != nil {
+		g.WebProxyGroupsHeader = *config.WebProxyGroups
+	}
+	if config.WebProxies != nil {
+		g.WebTrustedProxies = config.WebProxies
+	}
+	if config.LinkCheckInterval != nil {
+		g.LinkCheckInterval = *config.LinkCheckInterval
+	}
+	if config.LinkCheckExternal != nil {
+		g.LinkCheckExternal = *config.LinkCheckExternal
+	}
+	if config.LinkCheckDelay != nil {
+		g.LinkCheckDelay = *config.LinkCheckDelay
+	}
+}
+
+// EffectiveConfig returns each setting in the loaded config, and the
+// layer it was set in, see LoadConfig
+func (g *Gman) EffectiveConfig() []ConfigValue {
+	var values []ConfigValue
+	if g.config == nil {
+		return values
+	}
+	v := reflect.ValueOf(g.config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		if f.IsNil() {
+			continue
+		}
+		key := configKey(t.Field(i))
+		switch val := f.Interface().(type) {
+		case map[string]*Repo:
+			names := make([]string, 0, len(val))
+			for name := range val {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				r := val[name]
+				if r == nil {
+					continue
+				}
+				values = append(values, ConfigValue{
+					Key:    key + "." + name,
+					Value:  fmt.Sprintf("%s (%s)", r.URL, r.Branch),
+					Source: g.configSources[key+"."+name],
+				})
+			}
+			continue
+		case map[string]*ConfigFile:
+			for _, name := range ProfileNames(g.config) {
+				values = append(values, ConfigValue{
+					Key:    key + "." + name,
+					Value:  strings.Join(setKeys(val[name]), ","),
+					Source: g.configSources[key+"."+name],
+				})
+			}
+			continue
+		case []string:
+			values = append(values, ConfigValue{Key: key, Value: strings.Join(val, ","), Source: g.configSources[key]})
+			continue
+		}
+		values = append(values, ConfigValue{
+			Key:    key,
+			Value:  fmt.Sprint(f.Elem().Interface()),
+			Source: g.configSources[key],
+		})
+	}
+	return values
+}
+
+// setKeys returns the keys set in config
+func setKeys(config *ConfigFile) []string {
+	var keys []string
+	if config == nil {
+		return keys
+	}
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if !v.Field(i).IsNil() {
+			keys = append(keys, configKey(t.Field(i)))
+		}
+	}
+	return keys
 }
@@ -0,0 +1,211 @@
+package gman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlField returns the field of t set by key in the config file
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// configKeyType returns the type of the setting at a dotted key, eg.
+// pager or repos.foo.branch
+func configKeyType(key string) (reflect.Type, error) {
+	t := reflect.TypeOf(ConfigFile{})
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := yamlField(t, part)
+			if !ok {
+				return nil, fmt.Errorf("unknown key %s", strings.Join(parts[:i+1], "."))
+			}
+			t = f.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("unknown key %s, %s is not a section", key, strings.Join(parts[:i], "."))
+		}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t, nil
+}
+
+// readConfigNode reads a config file as a yaml document, which keeps its
+// comments and order when it is written back. A missing file is empty.
+func readConfigNode(file string) (*yaml.Node, error) {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	b, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode}}
+	}
+	return doc, nil
+}
+
+// writeConfigNode validates the document and writes it to file
+func writeConfigNode(file string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if errs := ValidateConfigFile(file, buf.Bytes()); len(errs) > 0 {
+		return errs
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+// SetConfigValue sets a dotted key in a config file, eg. pager or
+// repos.foo.branch. Lists are comma separated. The file is left as it
+// was if the change would make it invalid.
+func SetConfigValue(file string, key string, value string) error {
+	t, err := configKeyType(key)
+	if err != nil {
+		return err
+	}
+	if t.Kind() == reflect.Struct || t.Kind() == reflect.Map {
+		return fmt.Errorf("%s is a section, set its keys instead", key)
+	}
+	doc, err := readConfigNode(file)
+	if err != nil {
+		return err
+	}
+	n := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		_, v := mappingValue(n, part)
+		if v == nil || v.Kind != yaml.MappingNode {
+			v = &yaml.Node{Kind: yaml.MappingNode}
+			setMappingValue(n, part, v)
+		}
+		n = v
+	}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	switch t.Kind() {
+	case reflect.Slice:
+		v = &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range strings.Split(value, ",") {
+			v.Content = append(v.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+	case reflect.String:
+		// keep values such as "yes" or "1" as strings
+		v.Tag = "!!str"
+	}
+	setMappingValue(n, parts[len(parts)-1], v)
+	return writeConfigNode(file, doc)
+}
+
+// setMappingValue sets key in a mapping node, adding it if it isn't set
+func setMappingValue(n *yaml.Node, key string, v *yaml.Node) {
+	if k, old := mappingValue(n, key); k != nil {
+		// keep any comments on the old value
+		v.HeadComment, v.LineComment = old.HeadComment, old.LineComment
+		for i := 1; i < len(n.Content); i += 2 {
+			if n.Content[i] == old {
+				n.Content[i] = v
+			}
+		}
+		return
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+}
+
+// UnsetConfigValue removes a dotted key from a config file
+func UnsetConfigValue(file string, key string) error {
+	if _, err := configKeyType(key); err != nil {
+		return err
+	}
+	doc, err := readConfigNode(file)
+	if err != nil {
+		return err
+	}
+	n := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		if _, n = mappingValue(n, part); n == nil {
+			return fmt.Errorf("%s is not set in %s", key, file)
+		}
+	}
+	last := parts[len(parts)-1]
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Kind == yaml.MappingNode && n.Content[i].Value == last {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return writeConfigNode(file, doc)
+		}
+	}
+	return fmt.Errorf("%s is not set in %s", key, file)
+}
+
+// GetConfigValue returns the value of a dotted key in the loaded config,
+// and the layer it was set in, see LoadConfig. Sections are returned as yaml.
+func (g *Gman) GetConfigValue(key string) (string, string, error) {
+	if _, err := configKeyType(key); err != nil {
+		return "", "", err
+	}
+	if g.config == nil {
+		return "", "", errors.New("config not loaded")
+	}
+	var doc yaml.Node
+	if err := doc.Encode(g.config); err != nil {
+		return "", "", err
+	}
+	n := &doc
+	for _, part := range strings.Split(key, ".") {
+		if _, n = mappingValue(n, part); n == nil || n.Tag == "!!null" {
+			return "", "", fmt.Errorf("%s is not set", key)
+		}
+	}
+	value := n.Value
+	if n.Kind != yaml.ScalarNode {
+		b, err := yaml.Marshal(n)
+		if err != nil {
+			return "", "", err
+		}
+		value = strings.TrimSuffix(string(b), "\n")
+	}
+	// repos are recorded by name, so look for the longest recorded prefix
+	source := ""
+	for k := key; k != "" && source == ""; {
+		source = g.configSources[k]
+		i := strings.LastIndex(k, ".")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return value, source, nil
+}
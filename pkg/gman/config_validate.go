@@ -0,0 +1,269 @@
+package gman
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigSchema is the JSON Schema of the config file
+//
+//go:embed config.schema.json
+var ConfigSchema []byte
+
+// ConfigError is a problem found in the config
+type ConfigError struct {
+	// Source is the file the problem is in, or the layer if it wasn't read from a file
+	Source string `json:"source" yaml:"source"`
+	// Line is 0 if the problem isn't on a particular line
+	Line    int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Key     string `json:"key,omitempty" yaml:"key,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (e ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Source, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Source, e.Message)
+}
+
+// ConfigErrors are all the problems found in the config
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ce := range e {
+		msgs[i] = ce.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// yamlLineError matches the line number yaml prefixes its errors with
+var yamlLineError = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// badDuration matches yaml's error for a value which isn't a duration
+var badDuration = regexp.MustCompile("^cannot unmarshal !!\\w+ `(.*)` into time.Duration$")
+
+// unknownField matches yaml's error for a key which isn't in the struct
+var unknownField = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+
+func yamlErrors(source string, msgs []string) ConfigErrors {
+	var errs ConfigErrors
+	for _, msg := range msgs {
+		e := ConfigError{Source: source, Message: msg}
+		if m := yamlLineError.FindStringSubmatch(msg); m != nil {
+			e.Line, _ = strconv.Atoi(m[1])
+			e.Message = m[2]
+		}
+		if m := unknownField.FindStringSubmatch(e.Message); m != nil {
+			e.Key = m[1]
+			e.Message = "unknown key " + m[1]
+		}
+		if m := badDuration.FindStringSubmatch(e.Message); m != nil {
+			e.Message = fmt.Sprintf("invalid duration %q, eg. 2h or 30m", m[1])
+		}
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// mappingValue returns the key and value nodes of key in a mapping node, or nil
+func mappingValue(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// isRepoURL reports whether repo is the URL or path of a repo, rather
+// than the name of one of the configured repos
+func isRepoURL(repo string) bool {
+	return strings.Contains(repo, ":") || filepath.IsAbs(repo)
+}
+
+// ValidateConfigFile returns the problems in a config file: syntax errors,
+// unknown keys, values of the wrong type such as a bad interval, and
+// settings which don't make sense together. A repo which isn't in the
+// file's repos may be in another layer, so is checked by LoadConfig.
+func ValidateConfigFile(file string, b []byte) ConfigErrors {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return yamlErrors(file, []string{err.Error()})
+	}
+	if len(doc.Content) == 0 {
+		// an empty file is valid
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var config ConfigFile
+	var errs ConfigErrors
+	var terr *yaml.TypeError
+	if err := dec.Decode(&config); errors.As(err, &terr) {
+		errs = append(errs, yamlErrors(file, terr.Errors)...)
+	} else if err != nil && err != io.EOF {
+		return yamlErrors(file, []string{err.Error()})
+	}
+	root := doc.Content[0]
+	if k, v := mappingValue(root, "gitBackend"); v != nil && v.Value != GitBackendExec && v.Value != GitBackendGo {
+		errs = append(errs, ConfigError{
+			Source:  file,
+			Line:    k.Line,
+			Key:     "gitBackend",
+			Message: fmt.Sprintf("unknown git backend %q, must be %s or %s", v.Value, GitBackendExec, GitBackendGo),
+		})
+	}
+	if k, v := mappingValue(root, "repo"); v != nil && v.Value != "" && !isRepoURL(v.Value) {
+		if _, r := mappingValue(root, "repos"); r != nil {
+			if rk, _ := mappingValue(r, v.Value); rk == nil {
+				errs = append(errs, ConfigError{
+					Source:  file,
+					Line:    k.Line,
+					Key:     "repo",
+					Message: fmt.Sprintf("repo %q is not in repos, and is not a URL", v.Value),
+				})
+			}
+		}
+	}
+	for name, r := range config.Repos {
+		if r != nil && r.URL != "" {
+			continue
+		}
+		_, repos := mappingValue(root, "repos")
+		k, _ := mappingValue(repos, name)
+		e := ConfigError{Source: file, Key: "repos." + name, Message: fmt.Sprintf("repos.%s has no url", name)}
+		if k != nil {
+			e.Line = k.Line
+		}
+		errs = append(errs, e)
+	}
+	for name, p := range config.Profiles {
+		if p == nil || p.Profile == nil && p.Profiles == nil {
+			continue
+		}
+		_, profiles := mappingValue(root, "profiles")
+		k, _ := mappingValue(profiles, name)
+		e := ConfigError{Source: file, Key: "profiles." + name, Message: fmt.Sprintf("profiles.%s can't select or define profiles", name)}
+		if k != nil {
+			e.Line = k.Line
+		}
+		errs = append(errs, e)
+	}
+	if (config.WebTLSCert == nil) != (config.WebTLSKey == nil) {
+		key := "webTLSCert"
+		if config.WebTLSCert == nil {
+			key = "webTLSKey"
+		}
+		k, _ := mappingValue(root, key)
+		errs = append(errs, ConfigError{
+			Source:  file,
+			Line:    k.Line,
+			Key:     key,
+			Message: "webTLSCert and webTLSKey must be set together",
+		})
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
+
+// configLine returns the line key is set on in a config file, or 0
+func configLine(file string, key string) int {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil || len(doc.Content) == 0 {
+		return 0
+	}
+	k, _ := mappingValue(doc.Content[0], key)
+	if k == nil {
+		return 0
+	}
+	return k.Line
+}
+
+// checkRepoRef checks the selected repo is either one of the configured
+// repos, or a URL
+func checkRepoRef(config *ConfigFile, layers []*configLayer) error {
+	if config.Repo == nil || *config.Repo == "" || config.Repos[*config.Repo] != nil || isRepoURL(*config.Repo) {
+		return nil
+	}
+	return layerError(layers, "repo", fmt.Sprintf("repo %q is not in repos, and is not a URL", *config.Repo))
+}
+
+// layerError reports a problem with the value of key, in the highest layer which set it
+func layerError(layers []*configLayer, key string, msg string) error {
+	e := ConfigError{Source: ConfigDefault, Key: key, Message: msg}
+	for i := len(layers) - 1; i >= 0; i-- {
+		layer := layers[i]
+		if !stringInSlice(key, setKeys(layer.config)) {
+			continue
+		}
+		e.Source = layer.source(key)
+		if layer.file != "" {
+			e.Source = layer.file
+			e.Line = configLine(layer.file, key)
+		}
+		break
+	}
+	return ConfigErrors{e}
+}
+
+// ValidateConfig returns the problems in each layer of config, see
+// LoadConfig. The gman repo's config is only checked once the other
+// layers are valid, as they choose the repo.
+func (g *Gman) ValidateConfig(flags *ConfigFile) (ConfigErrors, error) {
+	var errs ConfigErrors
+	validate := func(file string) error {
+		b, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		errs = append(errs, ValidateConfigFile(file, b)...)
+		return nil
+	}
+	for _, file := range []string{SystemConfigFile, g.UserConfigFile()} {
+		if err := validate(file); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := envConfig(); err != nil {
+		errs = append(errs, ConfigError{Source: ConfigEnv, Message: err.Error()})
+	}
+	if len(errs) > 0 {
+		return errs, nil
+	}
+	var cerrs ConfigErrors
+	if err := g.LoadConfig(flags); errors.As(err, &cerrs) {
+		return cerrs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if g.LocalDir != "" {
+		if err := validate(filepath.Join(g.LocalDir, RepoConfigFile)); err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
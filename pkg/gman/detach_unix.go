@@ -0,0 +1,14 @@
+//go:build !windows
+
+package gman
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in its own session, so it isn't killed along with
+// the terminal or by ctrl-c
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,153 @@
+package gman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// PageDiff is the change to one of an app's files between two revisions
+type PageDiff struct {
+	File string `json:"file" yaml:"file"`
+	From string `json:"from" yaml:"from"`
+	To   string `json:"to" yaml:"to"`
+	// Diff is a unified diff of the file
+	Diff string `json:"diff" yaml:"diff"`
+}
+
+// DiffApp returns the changes to the app's README and TLDR between two
+// revisions, see ResolveAppRev. Files which did not change are left out.
+func (g *Gman) DiffApp(ctx context.Context, app *App, from string, to string) ([]PageDiff, error) {
+	b, err := g.git()
+	if err != nil {
+		return nil, err
+	}
+	p, err := g.appPath(app)
+	if err != nil {
+		return nil, err
+	}
+	readme := "README.md"
+	if app.ReadmeFile != nil {
+		readme = filepath.Base(*app.ReadmeFile)
+	}
+	var diffs []PageDiff
+	for _, name := range []string{readme, "TLDR.md"} {
+		// a file which didn't exist at either revision diffs as empty
+		file := p + "/" + name
+		a, err := b.Show(ctx, g.LocalDir, from, file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		c, err := b.Show(ctx, g.LocalDir, to, file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if string(a) == string(c) {
+			continue
+		}
+		diffs = append(diffs, PageDiff{
+			File: file,
+			From: from,
+			To:   to,
+			Diff: unifiedDiff(file, from, to, string(a), string(c)),
+		})
+	}
+	return diffs, nil
+}
+
+// diffLine is a single line of a diff, prefixed with ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff formats the changes between a and b as a unified diff
+func unifiedDiff(file string, from string, to string, a string, b string) string {
+	var lines []diffLine
+	for _, d := range diff.Do(a, b) {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, diffLine{op: op, text: strings.TrimSuffix(text, "\n")})
+			}
+		}
+	}
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s (%s)\n+++ %s (%s)\n", file, from, file, to)
+	// line numbers in a and b of the start of lines[i]
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+		// start the hunk with some context before the change
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		// extend the hunk until there are more than twice the context of
+		// unchanged lines, so nearby changes share a hunk
+		end, unchanged := i, 0
+		for ; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		end -= unchanged - diffContext
+		if unchanged < diffContext {
+			end = len(lines)
+		}
+		var aCount, bCount int
+		var hunk strings.Builder
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+			hunk.WriteByte(l.op)
+			hunk.WriteString(l.text)
+			hunk.WriteByte('\n')
+		}
+		// an empty side starts at the line before the hunk
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", aStart, aCount, bStart, bCount, hunk.String())
+		for _, l := range lines[i:end] {
+			if l.op != '+' {
+				aLine++
+			}
+			if l.op != '-' {
+				bLine++
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
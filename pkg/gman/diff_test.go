@@ -0,0 +1,83 @@
+package gman
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// numberedLines returns "line n" for each n from first to last, one per line
+func numberedLines(first int, last int) string {
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	header := "--- f (a)\n+++ f (b)\n"
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{
+			name: "unchanged",
+			a:    numberedLines(1, 3),
+			b:    numberedLines(1, 3),
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    numberedLines(1, 10),
+			b:    strings.Replace(numberedLines(1, 10), "line 5\n", "line five\n", 1),
+			want: "@@ -2,7 +2,7 @@\n line 2\n line 3\n line 4\n-line 5\n+line five\n line 6\n line 7\n line 8\n",
+		},
+		{
+			name: "added at end",
+			a:    numberedLines(1, 2),
+			b:    numberedLines(1, 3),
+			want: "@@ -1,2 +1,3 @@\n line 1\n line 2\n+line 3\n",
+		},
+		{
+			name: "removed at start",
+			a:    numberedLines(1, 3),
+			b:    numberedLines(2, 3),
+			want: "@@ -1,3 +1,2 @@\n-line 1\n line 2\n line 3\n",
+		},
+		{
+			name: "new file",
+			a:    "",
+			b:    numberedLines(1, 2),
+			want: "@@ -0,0 +1,2 @@\n+line 1\n+line 2\n",
+		},
+		{
+			name: "removed file",
+			a:    numberedLines(1, 2),
+			b:    "",
+			want: "@@ -1,2 +0,0 @@\n-line 1\n-line 2\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			a:    numberedLines(1, 20),
+			b:    strings.Replace(strings.Replace(numberedLines(1, 20), "line 2\n", "x\n", 1), "line 18\n", "y\n", 1),
+			want: "@@ -1,5 +1,5 @@\n line 1\n-line 2\n+x\n line 3\n line 4\n line 5\n" +
+				"@@ -15,6 +15,6 @@\n line 15\n line 16\n line 17\n-line 18\n+y\n line 19\n line 20\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    numberedLines(1, 20),
+			b:    strings.Replace(strings.Replace(numberedLines(1, 20), "line 5\n", "x\n", 1), "line 9\n", "y\n", 1),
+			want: "@@ -2,11 +2,11 @@\n line 2\n line 3\n line 4\n-line 5\n+x\n line 6\n line 7\n line 8\n-line 9\n+y\n line 10\n line 11\n line 12\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f", "a", "b", tt.a, tt.b); got != header+tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, header+tt.want)
+			}
+		})
+	}
+}
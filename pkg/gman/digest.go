@@ -0,0 +1,182 @@
+package gman
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// updateFile records the commits the last update moved the checkout
+// between, relative to the root of the checkout
+const updateFile = ".git/gman-update.json"
+
+// Update is a pull which moved the checkout to a new commit
+type Update struct {
+	From    string    `json:"from" yaml:"from"`
+	To      string    `json:"to" yaml:"to"`
+	Updated time.Time `json:"updated" yaml:"updated"`
+	// Pending is set until the digest of the update has been shown, see PendingDigest
+	Pending bool `json:"pending" yaml:"pending"`
+}
+
+// AppChange is an app which was added, removed or modified by an update
+type AppChange struct {
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Name      string `json:"name" yaml:"name"`
+	// Change is one of FileAdded, FileRemoved or FileModified
+	Change string `json:"change" yaml:"change"`
+}
+
+// Digest summarizes the apps changed by an update
+type Digest struct {
+	From string      `json:"from" yaml:"from"`
+	To   string      `json:"to" yaml:"to"`
+	Apps []AppChange `json:"apps" yaml:"apps"`
+}
+
+func (g *Gman) readUpdate() (*Update, error) {
+	b, err := os.ReadFile(filepath.Join(g.LocalDir, updateFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	u := &Update{}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (g *Gman) writeUpdate(u *Update) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.LocalDir, updateFile), b, 0644)
+}
+
+// recordUpdate records that an update moved the checkout from one commit
+// to another. If the digest of an earlier update has not been shown yet,
+// the pending digest covers both.
+func (g *Gman) recordUpdate(from string, to string) error {
+	if from == to {
+		return nil
+	}
+	prev, err := g.readUpdate()
+	if err != nil {
+		return err
+	}
+	if prev != nil && prev.Pending {
+		from = prev.From
+	}
+	return g.writeUpdate(&Update{
+		From:    from,
+		To:      to,
+		Updated: time.Now(),
+		Pending: true,
+	})
+}
+
+// DigestUpdate returns the apps changed between from and the current
+// checkout, in the namespaces in DigestNamespaces, or all namespaces if
+// it is empty
+func (g *Gman) DigestUpdate(ctx context.Context, from string) (*Digest, error) {
+	b, err := g.git()
+	if err != nil {
+		return nil, err
+	}
+	to, err := b.Head(ctx, g.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+	d := &Digest{From: from, To: to}
+	changes, err := b.Changes(ctx, g.LocalDir, from, to, "docs")
+	if err != nil {
+		return nil, err
+	}
+	// an app exists as long as it has a README, so read the apps in the
+	// checkout rather than the catalog, which may not be loaded
+	apps, err := g.readApps()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool)
+	for ns, nsApps := range apps {
+		for _, app := range nsApps {
+			current[ns+"/"+app.Name] = true
+		}
+	}
+	// index of each app in d.Apps
+	seen := make(map[string]int)
+	for _, c := range changes {
+		// docs/{namespace}/{app}/...
+		parts := strings.Split(c.Path, "/")
+		if len(parts) < 4 {
+			continue
+		}
+		if len(g.DigestNamespaces) > 0 && !stringInSlice(parts[1], g.DigestNamespaces) {
+			continue
+		}
+		key := parts[1] + "/" + parts[2]
+		readme := len(parts) == 4 && strings.EqualFold(parts[3], "README.md")
+		change := FileModified
+		switch {
+		case current[key] && readme && c.Change == FileAdded:
+			change = FileAdded
+		case !current[key] && readme && c.Change == FileRemoved:
+			change = FileRemoved
+		case !current[key]:
+			// not an app, or removed along with its README
+			continue
+		}
+		if i, ok := seen[key]; ok {
+			if change != FileModified {
+				d.Apps[i].Change = change
+			}
+			continue
+		}
+		seen[key] = len(d.Apps)
+		d.Apps = append(d.Apps, AppChange{Namespace: parts[1], Name: parts[2], Change: change})
+	}
+	log.WithFields(log.Fields{
+		"fn":   "DigestUpdate",
+		"from": from,
+		"to":   to,
+		"apps": len(d.Apps),
+	}).Debug("digested update")
+	return d, nil
+}
+
+// LastDigest returns the digest of the last update which moved the
+// checkout, or nil if there hasn't been one
+func (g *Gman) LastDigest(ctx context.Context) (*Digest, error) {
+	u, err := g.readUpdate()
+	if err != nil || u == nil {
+		return nil, err
+	}
+	return g.DigestUpdate(ctx, u.From)
+}
+
+// PendingDigest returns the digest of the updates since it was last
+// called, or nil if there haven't been any, so each change is only shown once
+func (g *Gman) PendingDigest(ctx context.Context) (*Digest, error) {
+	u, err := g.readUpdate()
+	if err != nil || u == nil || !u.Pending {
+		return nil, err
+	}
+	d, err := g.DigestUpdate(ctx, u.From)
+	if err != nil {
+		return nil, err
+	}
+	u.Pending = false
+	if err := g.writeUpdate(u); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
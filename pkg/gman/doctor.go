@@ -0,0 +1,387 @@
+package gman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
+	"github.com/fhs/go-netrc/netrc"
+	log "github.com/sirupsen/logrus"
+)
+
+// DoctorTimeout is how long gman doctor waits for the repo to respond
+var DoctorTimeout = 20 * time.Second
+
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning"
+	CheckError   = "error"
+	CheckSkipped = "skipped"
+)
+
+// Check is the result of one of gman doctor's checks
+type Check struct {
+	// Group is one of dependencies, config, credentials or repo
+	Group string `json:"group" yaml:"group"`
+	Name  string `json:"name" yaml:"name"`
+	// Status is one of CheckOK, CheckWarning, CheckError or CheckSkipped
+	Status  string `json:"status" yaml:"status"`
+	Message string `json:"message" yaml:"message"`
+	// Fix is what to do about a warning or error
+	Fix string `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// doctor collects the results of the checks
+type doctor struct {
+	checks []Check
+}
+
+func (d *doctor) add(group string, name string, status string, msg string, fix string) {
+	d.checks = append(d.checks, Check{Group: group, Name: name, Status: status, Message: msg, Fix: fix})
+}
+
+// Doctor checks the local install: the programs gman runs, the config
+// and credentials, and the health of the local copy of the repo. Each
+// problem found comes with a fix.
+func (g *Gman) Doctor(ctx context.Context, flags *ConfigFile) []Check {
+	l := log.WithField("fn", "Doctor")
+	l.Debug("checking install")
+	d := &doctor{}
+	loaded := g.doctorConfig(d, flags)
+	g.doctorDependencies(d)
+	if !loaded {
+		for _, group := range []string{"credentials", "repo"} {
+			d.add(group, group, CheckSkipped, "not checked, as the config is invalid", "")
+		}
+		return d.checks
+	}
+	g.doctorCredentials(d)
+	g.doctorRepo(ctx, d)
+	return d.checks
+}
+
+// doctorConfig validates the config, and reports whether it was loaded
+func (g *Gman) doctorConfig(d *doctor, flags *ConfigFile) bool {
+	errs, err := g.ValidateConfig(flags)
+	if err != nil {
+		d.add("config", "config", CheckError, err.Error(), "check the config files can be read")
+		return false
+	}
+	for _, e := range errs {
+		fix := fmt.Sprintf("fix %s", e.Source)
+		if e.Key != "" {
+			fix = fmt.Sprintf("fix %s, or remove it with gman config unset %s", e.Key, e.Key)
+		}
+		d.add("config", "config", CheckError, e.Error(), fix)
+	}
+	if len(errs) > 0 {
+		return false
+	}
+	// the config is valid, but ValidateConfig may not have loaded it
+	if err := g.LoadConfig(flags); err != nil {
+		d.add("config", "config", CheckError, err.Error(), "see gman config validate")
+		return false
+	}
+	file := g.UserConfigFile()
+	if _, err := os.Stat(file); err != nil {
+		file = "no user config file"
+	}
+	d.add("config", "config", CheckOK, fmt.Sprintf("valid, %s", file), "")
+	if g.Repo == nil || g.Repo.URL == "" {
+		d.add("config", "repo", CheckError, "no repo configured", "run gman init to set one up")
+	} else {
+		d.add("config", "repo", CheckOK, g.Repo.URL, "")
+	}
+	return true
+}
+
+// installFix returns how to install a package on this machine
+func installFix(pkg string) string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "brew install " + pkg
+	case "windows":
+		return "choco install " + pkg
+	}
+	for _, pm := range [][2]string{
+		{"apt", "sudo apt install"},
+		{"pacman", "sudo pacman -S"},
+		{"apk", "sudo apk add"},
+		{"dnf", "sudo dnf install"},
+		{"yum", "sudo yum install"},
+	} {
+		if _, err := exec.LookPath(pm[0]); err == nil {
+			return pm[1] + " " + pkg
+		}
+	}
+	return "install " + pkg + " with your package manager"
+}
+
+// doctorDependencies checks the programs gman runs are installed. Those
+// which aren't needed with the current config are only warnings.
+func (g *Gman) doctorDependencies(d *doctor) {
+	pager := "less"
+	if f := strings.Fields(g.Pager); len(f) > 0 {
+		pager = f[0]
+	}
+	opener, openerPkg := "xdg-open", "xdg-utils"
+	if runtime.GOOS == "darwin" {
+		opener, openerPkg = "open", ""
+	}
+	deps := []struct {
+		name   string
+		pkg    string
+		needed bool
+		why    string
+		alt    string
+	}{
+		{"git", "git", g.GitBackend != GitBackendGo, "to update the repo", "or use the built-in git with gman config set gitBackend go"},
+		{"pandoc", "pandoc", g.Render, "to render pages", "or show pages as markdown with gman config set render false"},
+		{"groff", "groff", g.Render, "to render pages", "or show pages as markdown with gman config set render false"},
+		{pager, pager, true, "to show pages", "or use another pager with gman config set pager more"},
+		{opener, openerPkg, OpenURLOnGetFailure, "to open pages which can't be fetched, with -open", ""},
+		{"node", "nodejs", g.WebMode, "to build the web server, with -web", ""},
+		{"npm", "npm", g.WebMode, "to build the web server, with -web", ""},
+	}
+	for _, dep := range deps {
+		if runtime.GOOS == "windows" && dep.name == opener {
+			// windows opens urls with the start shell command
+			continue
+		}
+		p, err := exec.LookPath(dep.name)
+		if err == nil {
+			d.add("dependencies", dep.name, CheckOK, p, "")
+			continue
+		}
+		fix := ""
+		if dep.pkg != "" {
+			fix = installFix(dep.pkg)
+		}
+		if dep.alt != "" {
+			fix = strings.TrimPrefix(fix+", "+dep.alt, ", ")
+		}
+		if !dep.needed {
+			d.add("dependencies", dep.name, CheckWarning, "not found, only needed "+dep.why, fix)
+			continue
+		}
+		d.add("dependencies", dep.name, CheckError, "not found, needed "+dep.why, fix)
+	}
+}
+
+// private reports whether a file can be read by other users
+func private(info os.FileInfo) bool {
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0077 == 0
+}
+
+// doctorCredentials checks the netrc file and ssh key can be used
+func (g *Gman) doctorCredentials(d *doctor) {
+	file := utils.NetrcFile
+	configured := file != ""
+	if !configured {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			d.add("credentials", "netrc", CheckError, err.Error(), "set HOME, or auth.netrc in the config")
+			return
+		}
+		file = filepath.Join(home, ".netrc")
+	}
+	info, err := os.Stat(file)
+	switch {
+	case os.IsNotExist(err) && configured:
+		d.add("credentials", "netrc", CheckError, fmt.Sprintf("auth.netrc %s does not exist", file), "create it, or remove it with gman config unset auth.netrc")
+	case os.IsNotExist(err):
+		d.add("credentials", "netrc", CheckOK, fmt.Sprintf("no %s, which is only needed for private repos and pages", file), "")
+	case err != nil:
+		d.add("credentials", "netrc", CheckError, err.Error(), fmt.Sprintf("check %s can be read", file))
+	default:
+		if _, _, err := netrc.ParseFile(file); err != nil {
+			d.add("credentials", "netrc", CheckError, fmt.Sprintf("unable to read %s: %v", file, err), "fix its syntax, each entry is: machine example.com login user password token")
+			break
+		}
+		if !private(info) {
+			d.add("credentials", "netrc", CheckWarning, fmt.Sprintf("%s can be read by other users", file), "chmod 600 "+file)
+			break
+		}
+		msg := file
+		// there may be no repo yet, eg. on first run
+		if g.Repo != nil {
+			if u, err := url.Parse(g.Repo.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				if m, err := netrc.FindMachine(file, u.Hostname()); err != nil || m == nil {
+					msg = fmt.Sprintf("%s has no credentials for %s, so the repo must be public", file, u.Hostname())
+				} else {
+					msg = fmt.Sprintf("%s has credentials for %s", file, u.Hostname())
+				}
+			}
+		}
+		d.add("credentials", "netrc", CheckOK, msg, "")
+	}
+	if g.Auth == nil || g.Auth.SSHKey == "" {
+		return
+	}
+	key := g.Auth.SSHKey
+	info, err = os.Stat(key)
+	switch {
+	case err != nil:
+		d.add("credentials", "sshKey", CheckError, fmt.Sprintf("unable to read auth.sshKey: %v", err), "set auth.sshKey to your private key, eg. ~/.ssh/id_ed25519")
+	case !private(info):
+		d.add("credentials", "sshKey", CheckError, fmt.Sprintf("%s can be read by other users, so ssh won't use it", key), "chmod 600 "+key)
+	default:
+		d.add("credentials", "sshKey", CheckOK, key, "")
+	}
+}
+
+// credentialsFix suggests how to give gman access to the repo
+func (g *Gman) credentialsFix() string {
+	if g.Repo == nil {
+		return "run gman init to set up a repo"
+	}
+	u, err := url.Parse(g.Repo.URL)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return fmt.Sprintf("check the url, and if the repo is private, add your credentials to ~/.netrc: machine %s login user password token", u.Hostname())
+	}
+	if err == nil && u.Scheme == "file" {
+		return "check the path exists"
+	}
+	return "check the url, and that your ssh key has access to the repo, or set auth.sshKey"
+}
+
+// doctorRepo checks the repo can be reached, and the local copy of it is
+// on the right branch, unchanged, and up to date
+func (g *Gman) doctorRepo(ctx context.Context, d *doctor) {
+	if g.Repo == nil || g.Repo.URL == "" {
+		d.add("repo", "repo", CheckSkipped, "no repo configured", "")
+		return
+	}
+	b, err := g.git()
+	if err != nil {
+		d.add("repo", "repo", CheckError, err.Error(), "")
+		return
+	}
+	rctx, cancel := context.WithTimeout(ctx, DoctorTimeout)
+	defer cancel()
+	if _, err := b.Tags(rctx, g.Repo); err != nil {
+		d.add("repo", "reachable", CheckError, fmt.Sprintf("unable to reach %s: %v", g.Repo.URL, err), g.credentialsFix())
+	} else {
+		d.add("repo", "reachable", CheckOK, g.Repo.URL, "")
+	}
+	if _, err := os.Stat(g.LocalDir); err != nil {
+		d.add("repo", "checkout", CheckWarning, fmt.Sprintf("%s has not been cloned yet", g.LocalDir), "gman -pull")
+		return
+	}
+	d.add("repo", "checkout", CheckOK, g.LocalDir, "")
+	g.doctorWritable(d)
+	if w, err := b.Worktree(ctx, g.LocalDir); err != nil {
+		d.add("repo", "worktree", CheckError, err.Error(), fmt.Sprintf("remove %s, and clone it again with gman -pull", g.LocalDir))
+	} else {
+		g.doctorWorktree(d, w)
+	}
+	g.doctorLastUpdate(d)
+	subs, err := g.SubmoduleStatus()
+	if err != nil {
+		d.add("repo", "submodules", CheckError, err.Error(), "gman -pull")
+		return
+	}
+	broken := 0
+	for _, s := range subs {
+		if s.Status == SubmoduleOK {
+			continue
+		}
+		broken++
+		fix := "gman -pull -log debug, to see why it can't be updated"
+		switch s.Status {
+		case SubmoduleAuthFailed:
+			fix = fmt.Sprintf("ask for access to %s, and add your credentials for it", s.URL)
+		case SubmoduleMissing:
+			fix = fmt.Sprintf("%s no longer exists, ask the repo's maintainers to remove the submodule", s.URL)
+		}
+		d.add("repo", "submodule "+s.Path, CheckWarning, fmt.Sprintf("%s: %s", s.Status, s.Error), fix)
+	}
+	if broken == 0 {
+		d.add("repo", "submodules", CheckOK, fmt.Sprintf("%d up to date", len(subs)), "")
+	}
+}
+
+// doctorWritable checks gman can update the local copy, which it can't
+// if it was run as another user, eg. with sudo
+func (g *Gman) doctorWritable(d *doctor) {
+	f, err := os.CreateTemp(filepath.Join(g.LocalDir, ".git"), "gman-doctor-")
+	if err != nil {
+		fix := fmt.Sprintf("sudo chown -R $(id -u) %s", g.LocalDir)
+		if runtime.GOOS == "windows" {
+			fix = fmt.Sprintf("give yourself write access to %s", g.LocalDir)
+		}
+		d.add("repo", "writable", CheckError, fmt.Sprintf("unable to write to %s, so it can't be updated: %v", g.LocalDir, err), fix)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func (g *Gman) doctorWorktree(d *doctor, w *Worktree) {
+	switch {
+	case g.Repo.Pinned() && w.Branch != "":
+		d.add("repo", "branch", CheckWarning, fmt.Sprintf("on branch %s, but the repo is pinned to %s", w.Branch, g.Repo.pin()), "gman -pull")
+	case g.Repo.Pinned():
+		d.add("repo", "branch", CheckOK, "pinned to "+g.Repo.pin(), "")
+	case w.Branch != g.Repo.Branch:
+		on := "a detached HEAD"
+		if w.Branch != "" {
+			on = "branch " + w.Branch
+		}
+		d.add("repo", "branch", CheckWarning, fmt.Sprintf("on %s, but the config follows %s", on, g.Repo.Branch), "gman -pull")
+	default:
+		d.add("repo", "branch", CheckOK, w.Branch, "")
+	}
+	if len(w.Changed) == 0 {
+		d.add("repo", "changes", CheckOK, "no local changes", "")
+		return
+	}
+	eg := w.Changed
+	if len(eg) > 3 {
+		eg = eg[:3]
+	}
+	d.add("repo", "changes", CheckWarning,
+		fmt.Sprintf("%d files changed locally, eg. %s, which the next update will discard", len(w.Changed), strings.Join(eg, ", ")),
+		"make changes in a clone of the repo instead, and gman -pull to reset the local copy")
+}
+
+// doctorLastUpdate checks the repo has been updated recently, which it
+// won't have been if updates are failing
+func (g *Gman) doctorLastUpdate(d *doctor) {
+	lu, err := g.LastUpdated()
+	if errors.Is(err, os.ErrNotExist) {
+		d.add("repo", "last update", CheckWarning, "not updated since it was cloned, so every run will update it", "gman -pull")
+		return
+	} else if err != nil {
+		d.add("repo", "last update", CheckError, err.Error(), "gman -pull")
+		return
+	}
+	ago := time.Since(lu).Round(time.Minute)
+	if g.UpdateInterval > 0 && ago > 2*g.UpdateInterval {
+		fix := "gman -pull, to see why updates are failing"
+		if g.BackgroundUpdate {
+			fix += fmt.Sprintf(", and see the background update log %s", g.UpdateLogFile())
+		}
+		d.add("repo", "last update", CheckWarning, fmt.Sprintf("last updated %s ago, but it should update every %s", ago, g.UpdateInterval), fix)
+		return
+	}
+	d.add("repo", "last update", CheckOK, fmt.Sprintf("%s ago", ago), "")
+}
+
+// DoctorFailed reports whether any of the checks found an error
+func DoctorFailed(checks []Check) bool {
+	for _, c := range checks {
+		if c.Status == CheckError {
+			return true
+		}
+	}
+	return false
+}
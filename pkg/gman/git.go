@@ -1,9 +1,9 @@
 package gman
 
 import (
+	"context"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"time"
 
@@ -28,62 +28,62 @@ func (g *Gman) RepoDir() string {
 	return p
 }
 
-func (g *Gman) GitClone() error {
-	cmd := exec.Command("git", "clone", "-b", g.Repo.Branch, g.Repo.URL, g.LocalDir)
-	if log.GetLevel() >= log.DebugLevel {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err := cmd.Run()
+// git returns the configured git backend
+func (g *Gman) git() (GitBackend, error) {
+	return NewGitBackend(g.GitBackend, g.Auth)
+}
+
+func (g *Gman) GitClone(ctx context.Context) error {
+	b, err := g.git()
 	if err != nil {
 		return err
 	}
-	if err := g.GitUpdateSubmodules(); err != nil {
+	if err := b.Clone(ctx, g.Repo, g.LocalDir); err != nil {
+		return err
+	}
+	if g.Repo.Pinned() {
+		if err := g.gitCheckout(ctx, b); err != nil {
+			return err
+		}
+	}
+	// verify before updating submodules, which may point anywhere
+	if err := g.gitVerify(ctx, b); err != nil {
+		return err
+	}
+	if err := g.GitUpdateSubmodules(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (g *Gman) GitPull() error {
+func (g *Gman) GitPull(ctx context.Context) error {
 	l := log.WithField("fn", "GitPull")
 	l.Debug("pulling git repo")
-	// update our local git repo to the latest and ensure we're on the right branch
-	cmd := exec.Command("git", "pull", "origin", g.Repo.Branch)
-	cmd.Dir = g.LocalDir
-	l.WithField("dir", g.LocalDir).Debug("running git pull")
-	if log.GetLevel() >= log.DebugLevel {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err := cmd.Run()
+	b, err := g.git()
 	if err != nil {
-		l.WithError(err).Error("error running git pull")
 		return err
 	}
-	cmd = exec.Command("git", "checkout", g.Repo.Branch)
-	cmd.Dir = g.LocalDir
-	if log.GetLevel() >= log.DebugLevel {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err = cmd.Run()
-	if err != nil {
-		l.WithError(err).Error("error running git checkout")
+	if g.Repo.Pinned() {
+		l.WithField("dir", g.LocalDir).Debug("checking out pinned ref")
+		if err := g.gitCheckout(ctx, b); err != nil {
+			l.WithError(err).Error("error checking out pinned ref")
+			return err
+		}
+	} else {
+		l.WithField("dir", g.LocalDir).Debug("running git pull")
+		if err := b.Pull(ctx, g.Repo, g.LocalDir); err != nil {
+			l.WithError(err).Error("error running git pull")
+			return err
+		}
+		if err := g.writeActiveRef(nil); err != nil {
+			return err
+		}
+	}
+	if err := g.gitVerify(ctx, b); err != nil {
+		l.WithError(err).Error("error verifying update")
 		return err
 	}
-	// git reset --hard origin/{branch}
-	cmd = exec.Command("git", "reset", "--hard", "origin/"+g.Repo.Branch)
-	cmd.Dir = g.LocalDir
-	if log.GetLevel() >= log.DebugLevel {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err = cmd.Run()
-	if err != nil {
-		l.WithError(err).Error("error running git reset")
-		return err
-	}
-	if err := g.GitUpdateSubmodules(); err != nil {
+	if err := g.GitUpdateSubmodules(ctx); err != nil {
 		l.WithError(err).Error("error running git update submodules")
 		return err
 	}
@@ -101,45 +101,110 @@ func (g *Gman) LastUpdated() (time.Time, error) {
 	return stat.ModTime(), nil
 }
 
-func (g *Gman) GitUpdateSubmodules() error {
-	// update submodules
-	cmd := exec.Command("git", "submodule", "update", "--init", "--recursive")
-	cmd.Dir = g.LocalDir
-	if log.GetLevel() >= log.DebugLevel {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	}
-	err := cmd.Run()
+// GitUpdateSubmodules updates each submodule, skipping any which fail,
+// and records their status
+func (g *Gman) GitUpdateSubmodules(ctx context.Context) error {
+	b, err := g.git()
 	if err != nil {
 		return err
 	}
-	return nil
+	subs, err := b.UpdateSubmodules(ctx, g.Repo, g.LocalDir)
+	if err != nil {
+		return err
+	}
+	logSubmodules(subs)
+	return g.writeSubmoduleStatus(subs)
 }
 
-func (g *Gman) GitUpdate() error {
-	l := log.WithField("fn", "GitUpdate")
-	l.Debug("updating git repo")
-	// if repo doesn't exist, clone it
-	if _, err := os.Stat(g.LocalDir); os.IsNotExist(err) {
-		l.Debug("repo does not exist, cloning")
-		return g.GitClone()
-	}
+// updateDue returns why the checkout should be updated, or an empty
+// string if it is up to date
+func (g *Gman) updateDue() string {
 	if g.ForceUpdate {
-		l.Debug("force update set, pulling")
-		return g.GitPull()
+		return "force update set"
+	}
+	// if the pin has changed since the last update, check out the new ref now
+	if active, err := g.ActiveRef(); err == nil && active.Pin != g.Repo.pin() {
+		return "pinned ref changed"
 	}
 	// if repo exists and we have updated within the update interval, do nothing
 	// otherwise, pull
 	lastUpdated, err := g.LastUpdated()
 	if err != nil {
-		l.Debug("unable to get last updated time, pulling")
 		// if we can't get the last updated time, pull
-		return g.GitPull()
+		return "unable to get last updated time"
 	}
 	if lastUpdated.IsZero() || g.UpdateInterval > 0 && lastUpdated.Add(g.UpdateInterval).Before(time.Now()) {
-		l.Debug("last updated time is before update interval, pulling")
-		return g.GitPull()
+		return "last updated time is before update interval"
 	}
-	l.Debug("last updated time is after update interval, not pulling")
-	return nil
+	return ""
+}
+
+// GitUpdate clones the repo, or pulls it if an update is due. Only one
+// process updates a checkout at a time, and not while others are reading
+// it, see LockForRead. A process which waited for another to update it
+// uses the updated checkout rather than updating it again.
+func (g *Gman) GitUpdate(ctx context.Context) error {
+	l := log.WithField("fn", "GitUpdate")
+	l.Debug("updating git repo")
+	// if repo doesn't exist, clone it
+	if _, err := os.Stat(g.LocalDir); os.IsNotExist(err) {
+		l.Debug("repo does not exist, cloning")
+		// there is nothing to read until the clone is done, so wait for
+		// any other process cloning it
+		lock, err := g.lockRepo(ctx, true)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+		if _, err := os.Stat(g.LocalDir); err == nil {
+			l.Debug("repo was cloned by another process")
+			return nil
+		}
+		return g.GitClone(ctx)
+	}
+	if g.updateDue() == "" {
+		l.Debug("last updated time is after update interval, not pulling")
+		return nil
+	}
+	waitStart := time.Now()
+	lctx, cancel := context.WithTimeout(ctx, UpdateLockTimeout)
+	defer cancel()
+	lock, err := g.lockRepo(lctx, true)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// the update is still due, so it is tried again next time
+		l.WithError(err).Warn("repo is in use by another gman process, using current checkout")
+		return nil
+	}
+	defer lock.unlock()
+	// another process may have updated it while we waited for the lock,
+	// which satisfies a forced update too
+	reason := g.updateDue()
+	if last, err := g.LastUpdated(); err == nil && last.After(waitStart) {
+		reason = ""
+	}
+	if reason == "" {
+		l.Debug("repo was updated by another process")
+		return nil
+	}
+	b, err := g.git()
+	if err != nil {
+		return err
+	}
+	from, err := b.Head(ctx, g.LocalDir)
+	if err != nil {
+		return err
+	}
+	l.Debugf("%s, pulling", reason)
+	if err := g.GitPull(ctx); err != nil {
+		return err
+	}
+	// record which commits the pull moved between, for the update digest
+	to, err := b.Head(ctx, g.LocalDir)
+	if err != nil {
+		return err
+	}
+	return g.recordUpdate(from, to)
 }
@@ -0,0 +1,134 @@
+package gman
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	// GitBackendExec shells out to the git binary
+	GitBackendExec = "exec"
+	// GitBackendGo uses an in-process git implementation, and does not
+	// require git to be installed
+	GitBackendGo = "go"
+)
+
+// pinnedRef is the local ref the pinned ref, tag or commit is fetched to
+const pinnedRef = plumbing.ReferenceName("refs/gman/pinned")
+
+// GitBackend performs git operations on the local checkout of a repo
+type GitBackend interface {
+	// Clone clones the repo's branch into dir, honoring the repo's depth and sparse settings
+	Clone(ctx context.Context, repo *Repo, dir string) error
+	// Pull fetches the repo's branch and hard resets dir to it, keeping
+	// the checkout's depth and sparse paths in line with the repo's settings
+	Pull(ctx context.Context, repo *Repo, dir string) error
+	// UpdateSubmodules initializes and updates each checked out submodule,
+	// recursively. A submodule which fails to update is skipped, and
+	// reported in its status rather than as an error.
+	UpdateSubmodules(ctx context.Context, repo *Repo, dir string) ([]SubmoduleStatus, error)
+	// Checkout fetches rev, which may be a ref, tag or commit, and hard
+	// resets dir to it with a detached HEAD
+	Checkout(ctx context.Context, repo *Repo, dir string, rev string) error
+	// Reset hard resets dir to a commit which has already been fetched,
+	// with a detached HEAD
+	Reset(ctx context.Context, repo *Repo, dir string, commit string) error
+	// Tags lists the tags on the repo's remote
+	Tags(ctx context.Context, repo *Repo) ([]string, error)
+	// Head returns the commit checked out in dir
+	Head(ctx context.Context, dir string) (string, error)
+	// Log returns the commits from HEAD which changed path, a file or
+	// directory relative to dir, newest first. If limit is more than 0,
+	// at most limit commits are returned.
+	Log(ctx context.Context, dir string, path string, limit int) ([]Commit, error)
+	// Show returns the contents of path, relative to dir, at rev. If path
+	// does not exist at rev, the error wraps os.ErrNotExist.
+	Show(ctx context.Context, dir string, rev string, path string) ([]byte, error)
+	// Changes returns the files under path, relative to dir, which differ
+	// between two commits
+	Changes(ctx context.Context, dir string, from string, to string, path string) ([]FileChange, error)
+	// Worktree returns the branch checked out in dir, and the files which
+	// differ from HEAD
+	Worktree(ctx context.Context, dir string) (*Worktree, error)
+}
+
+const (
+	FileAdded    = "added"
+	FileRemoved  = "removed"
+	FileModified = "modified"
+)
+
+// FileChange is a file which differs between two commits
+type FileChange struct {
+	// Path is relative to the root of the repo
+	Path string `json:"path" yaml:"path"`
+	// Change is one of FileAdded, FileRemoved or FileModified
+	Change string `json:"change" yaml:"change"`
+}
+
+// Worktree is the state of the files checked out in a repo
+type Worktree struct {
+	// Branch is empty if HEAD is detached, eg. when the repo is pinned
+	Branch string `json:"branch" yaml:"branch"`
+	// Changed are the files which are modified, added or untracked,
+	// relative to the root of the repo
+	Changed []string `json:"changed" yaml:"changed"`
+}
+
+// Commit is a commit in the history of the repo
+type Commit struct {
+	Hash    string    `json:"hash" yaml:"hash"`
+	Author  string    `json:"author" yaml:"author"`
+	Date    time.Time `json:"date" yaml:"date"`
+	Subject string    `json:"subject" yaml:"subject"`
+}
+
+// GitError is returned when a git operation fails
+type GitError struct {
+	// Backend is the git backend which ran the operation
+	Backend string
+	// Op is the operation which failed, eg. clone, fetch, reset
+	Op string
+	// Dir is the local checkout the operation ran in
+	Dir string
+	// Output is any output from git, which usually describes the failure
+	Output string
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	msg := fmt.Sprintf("git %s (%s) in %s: %v", e.Op, e.Backend, e.Dir, e.Err)
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+func (e *GitError) Unwrap() error {
+	return e.Err
+}
+
+// NewGitBackend returns the backend with the given name, using the
+// credentials in auth if it is set. An empty name returns the default
+// exec backend.
+func NewGitBackend(name string, auth *Auth) (GitBackend, error) {
+	switch strings.ToLower(name) {
+	case "", GitBackendExec:
+		env, err := auth.gitEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &execGit{env: env}, nil
+	case GitBackendGo:
+		g := &goGit{}
+		if auth != nil {
+			g.sshKey = auth.SSHKey
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("unknown git backend %q, must be one of: %s, %s", name, GitBackendExec, GitBackendGo)
+}
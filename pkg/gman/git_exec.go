@@ -0,0 +1,422 @@
+package gman
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// execGit runs git operations with the git binary
+type execGit struct {
+	// env is set on every git command, eg. for credentials, see Auth
+	env []string
+}
+
+// run runs git in dir, capturing its output so it can be reported
+// on failure. The output is also streamed when debug logging is on.
+func (e *execGit) run(ctx context.Context, op string, dir string, args ...string) error {
+	return e.runEnv(ctx, nil, op, dir, args...)
+}
+
+// runEnv runs git with additional environment variables
+func (e *execGit) runEnv(ctx context.Context, env []string, op string, dir string, args ...string) error {
+	l := log.WithFields(log.Fields{
+		"fn":  "execGit.run",
+		"op":  op,
+		"dir": dir,
+	})
+	l.Debugf("running git %s", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if env != nil || e.env != nil {
+		cmd.Env = append(append(os.Environ(), e.env...), env...)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if log.GetLevel() >= log.DebugLevel {
+		cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+		cmd.Stderr = io.MultiWriter(os.Stderr, &out)
+	}
+	err := cmd.Run()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			err = errors.New("git is not installed, install it or set gitBackend to go")
+		}
+		return &GitError{
+			Backend: GitBackendExec,
+			Op:      op,
+			Dir:     dir,
+			Output:  strings.TrimSpace(out.String()),
+			Err:     err,
+		}
+	}
+	return nil
+}
+
+// output runs git in dir and returns its stdout
+func (e *execGit) output(ctx context.Context, op string, dir string, args ...string) (string, error) {
+	log.WithFields(log.Fields{
+		"fn":  "execGit.output",
+		"op":  op,
+		"dir": dir,
+	}).Debugf("running git %s", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if e.env != nil {
+		cmd.Env = append(os.Environ(), e.env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			err = errors.New("git is not installed, install it or set gitBackend to go")
+		}
+		return "", &GitError{
+			Backend: GitBackendExec,
+			Op:      op,
+			Dir:     dir,
+			Output:  strings.TrimSpace(stderr.String()),
+			Err:     err,
+		}
+	}
+	return stdout.String(), nil
+}
+
+func (e *execGit) Clone(ctx context.Context, repo *Repo, dir string) error {
+	args := []string{"clone", "-b", repo.Branch}
+	if repo.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(repo.Depth))
+	}
+	if repo.Sparse {
+		// only fetch the blobs we check out, and check out once the
+		// sparse paths have been set
+		args = append(args, "--filter=blob:none", "--no-checkout")
+	}
+	args = append(args, repo.URL, dir)
+	err := e.run(ctx, "clone", "", args...)
+	var gerr *GitError
+	if errors.As(err, &gerr) {
+		// clone runs outside of the checkout, but report where it was going
+		gerr.Dir = dir
+	}
+	if err != nil || !repo.Sparse {
+		return err
+	}
+	if err := e.sparse(ctx, repo, dir); err != nil {
+		return err
+	}
+	return e.run(ctx, "checkout", dir, "checkout", repo.Branch)
+}
+
+// sparse applies the repo's sparse settings to an existing checkout
+func (e *execGit) sparse(ctx context.Context, repo *Repo, dir string) error {
+	if repo.Sparse {
+		args := append([]string{"sparse-checkout", "set", "--cone"}, repo.SparsePaths()...)
+		return e.run(ctx, "sparse-checkout", dir, args...)
+	}
+	// the repo may have been sparse previously
+	if _, err := os.Stat(filepath.Join(dir, ".git", "info", "sparse-checkout")); err == nil {
+		return e.run(ctx, "sparse-checkout", dir, "sparse-checkout", "disable")
+	}
+	return nil
+}
+
+func (e *execGit) Pull(ctx context.Context, repo *Repo, dir string) error {
+	// fetch the branch, keeping the history at the configured depth
+	args := []string{"fetch"}
+	if repo.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(repo.Depth))
+	} else if _, err := os.Stat(filepath.Join(dir, ".git", "shallow")); err == nil {
+		// the repo was previously shallow, fetch the full history
+		args = append(args, "--unshallow")
+	}
+	args = append(args, "origin", fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", repo.Branch, repo.Branch))
+	if err := e.run(ctx, "fetch", dir, args...); err != nil {
+		return err
+	}
+	if err := e.sparse(ctx, repo, dir); err != nil {
+		return err
+	}
+	// ensure we're on the right branch
+	if err := e.run(ctx, "checkout", dir, "checkout", repo.Branch); err != nil {
+		return err
+	}
+	// git reset --hard origin/{branch}
+	return e.run(ctx, "reset", dir, "reset", "--hard", "origin/"+repo.Branch)
+}
+
+func (e *execGit) UpdateSubmodules(ctx context.Context, repo *Repo, dir string) ([]SubmoduleStatus, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".gitmodules")); os.IsNotExist(err) {
+		return nil, nil
+	}
+	out, err := e.output(ctx, "submodule update", dir, "config", "-f", ".gitmodules", "--get-regexp", `^submodule\..*\.(path|url)$`)
+	if err != nil {
+		return nil, err
+	}
+	// submodule.<name>.path and submodule.<name>.url, by name
+	paths := make(map[string]string)
+	urls := make(map[string]string)
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		name := strings.TrimPrefix(key[:strings.LastIndex(key, ".")], "submodule.")
+		if strings.HasSuffix(key, ".path") {
+			paths[name] = value
+			names = append(names, name)
+		} else {
+			urls[name] = value
+		}
+	}
+	var sparse []string
+	if repo.Sparse {
+		for _, p := range repo.SparsePaths() {
+			sparse = append(sparse, p+"/")
+		}
+	}
+	var subs []SubmoduleStatus
+	for _, name := range names {
+		p := paths[name]
+		if sparse != nil && !inSparseDirs(p, sparse) {
+			// only update submodules inside the sparse checkout
+			continue
+		}
+		args := []string{"submodule", "update", "--init", "--recursive"}
+		if repo.Depth > 0 {
+			args = append(args, "--depth", strconv.Itoa(repo.Depth))
+		}
+		args = append(args, "--", p)
+		// fail rather than prompt for credentials, so inaccessible submodules are skipped
+		err := e.runEnv(ctx, []string{"GIT_TERMINAL_PROMPT=0"}, "submodule update", dir, args...)
+		if ctx.Err() != nil {
+			return subs, ctx.Err()
+		}
+		s := SubmoduleStatus{
+			Path:    p,
+			URL:     urls[name],
+			Status:  SubmoduleOK,
+			Updated: time.Now(),
+		}
+		var gerr *GitError
+		if errors.As(err, &gerr) {
+			s.Status = execSubmoduleStatus(gerr.Output)
+			s.Error = execErrorSummary(gerr.Output)
+		} else if err != nil {
+			s.Status = SubmoduleError
+			s.Error = err.Error()
+		}
+		subs = append(subs, s)
+	}
+	return subs, nil
+}
+
+// execErrorSummary returns the first fatal error from git's output,
+// which is usually the cause, or the last line if there isn't one
+func execErrorSummary(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	for _, line := range lines {
+		if msg, ok := strings.CutPrefix(line, "fatal: "); ok {
+			return msg
+		}
+	}
+	return lines[len(lines)-1]
+}
+
+// execSubmoduleStatus classifies a failed submodule update from git's output
+func execSubmoduleStatus(out string) string {
+	o := strings.ToLower(out)
+	for _, s := range []string{"authentication failed", "could not read username", "could not read password", "permission denied", "access denied", "403"} {
+		if strings.Contains(o, s) {
+			return SubmoduleAuthFailed
+		}
+	}
+	for _, s := range []string{"not found", "does not exist", "does not appear to be a git repository", "not our ref", "unadvertised object", "unable to find current revision"} {
+		if strings.Contains(o, s) {
+			return SubmoduleMissing
+		}
+	}
+	return SubmoduleError
+}
+
+func (e *execGit) Checkout(ctx context.Context, repo *Repo, dir string, rev string) error {
+	args := []string{"fetch"}
+	if repo.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(repo.Depth))
+	}
+	target := "FETCH_HEAD"
+	if err := e.run(ctx, "fetch", dir, append(args, "origin", fmt.Sprintf("+%s:%s", rev, pinnedRef))...); err != nil {
+		if !isAbbrevHash(rev) {
+			return err
+		}
+		// servers only fetch full commit hashes. fetch the full history
+		// of every branch and find it there.
+		args = []string{"fetch"}
+		if _, err := os.Stat(filepath.Join(dir, ".git", "shallow")); err == nil {
+			args = append(args, "--unshallow")
+		}
+		args = append(args, "origin", "+refs/heads/*:refs/remotes/origin/*")
+		if err := e.run(ctx, "fetch", dir, args...); err != nil {
+			return err
+		}
+		target = rev + "^{commit}"
+		if err := e.run(ctx, "update-ref", dir, "update-ref", "-d", pinnedRef.String()); err != nil {
+			return err
+		}
+	}
+	return e.Reset(ctx, repo, dir, target)
+}
+
+func (e *execGit) Reset(ctx context.Context, repo *Repo, dir string, commit string) error {
+	if err := e.sparse(ctx, repo, dir); err != nil {
+		return err
+	}
+	if err := e.run(ctx, "checkout", dir, "-c", "advice.detachedHead=false", "checkout", "--detach", commit); err != nil {
+		return err
+	}
+	return e.run(ctx, "reset", dir, "reset", "--hard", commit)
+}
+
+// isAbbrevHash reports whether s may be an abbreviated commit hash
+func isAbbrevHash(s string) bool {
+	if len(s) < 4 || len(s) >= 40 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *execGit) Tags(ctx context.Context, repo *Repo) ([]string, error) {
+	out, err := e.output(ctx, "ls-remote", "", "ls-remote", "--tags", "--refs", repo.URL)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		tags = append(tags, strings.TrimPrefix(fields[1], "refs/tags/"))
+	}
+	return tags, nil
+}
+
+func (e *execGit) Head(ctx context.Context, dir string) (string, error) {
+	out, err := e.output(ctx, "rev-parse", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (e *execGit) Log(ctx context.Context, dir string, path string, limit int) ([]Commit, error) {
+	// fields are separated by the unit separator, which won't appear in a subject
+	args := []string{"log", "--format=%H%x1f%an%x1f%aI%x1f%s"}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	out, err := e.output(ctx, "log", dir, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Date:    date,
+			Subject: fields[3],
+		})
+	}
+	return commits, nil
+}
+
+func (e *execGit) Show(ctx context.Context, dir string, rev string, path string) ([]byte, error) {
+	out, err := e.output(ctx, "show", dir, "show", rev+":"+path)
+	var gerr *GitError
+	if errors.As(err, &gerr) && (strings.Contains(gerr.Output, "does not exist") || strings.Contains(gerr.Output, "exists on disk, but not in")) {
+		gerr.Err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+func (e *execGit) Changes(ctx context.Context, dir string, from string, to string, path string) ([]FileChange, error) {
+	// -z leaves paths unquoted, as status and path separated by NULs
+	out, err := e.output(ctx, "diff", dir, "diff", "--name-status", "--no-renames", "-z", from, to, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var changes []FileChange
+	for i := 0; i+1 < len(fields); i += 2 {
+		change := FileModified
+		switch fields[i] {
+		case "A":
+			change = FileAdded
+		case "D":
+			change = FileRemoved
+		}
+		changes = append(changes, FileChange{Path: fields[i+1], Change: change})
+	}
+	return changes, nil
+}
+
+func (e *execGit) Worktree(ctx context.Context, dir string) (*Worktree, error) {
+	// -z leaves paths unquoted. The first entry is the branch, eg.
+	// ## main...origin/main, or ## HEAD (no branch)
+	out, err := e.output(ctx, "status", dir, "status", "--porcelain=v1", "--branch", "-z")
+	if err != nil {
+		return nil, err
+	}
+	w := &Worktree{}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if branch, ok := strings.CutPrefix(f, "## "); ok {
+			branch, _, _ = strings.Cut(branch, "...")
+			branch = strings.TrimPrefix(branch, "No commits yet on ")
+			if !strings.HasPrefix(branch, "HEAD ") {
+				w.Branch = branch
+			}
+			continue
+		}
+		if len(f) < 4 {
+			continue
+		}
+		w.Changed = append(w.Changed, f[3:])
+		// renames and copies are followed by the path they came from
+		if f[0] == 'R' || f[0] == 'C' {
+			i++
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,588 @@
+package gman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	log "github.com/sirupsen/logrus"
+
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
+)
+
+// goGit runs git operations in-process, without the git binary
+type goGit struct {
+	// sshKey is the private key for ssh remotes, see Auth
+	sshKey string
+}
+
+func (e *goGit) error(op string, dir string, err error) error {
+	return &GitError{
+		Backend: GitBackendGo,
+		Op:      op,
+		Dir:     dir,
+		Err:     err,
+	}
+}
+
+// auth returns credentials for http(s) remotes from the netrc file, and
+// for ssh remotes from the configured key. Otherwise remotes use the
+// go-git defaults, eg. the ssh agent for ssh remotes.
+func (e *goGit) auth(remote string) transport.AuthMethod {
+	ep, err := transport.NewEndpoint(remote)
+	if err != nil {
+		return nil
+	}
+	switch ep.Protocol {
+	case "http", "https":
+		login, password := utils.AuthForDomain(ep.Host)
+		if login == nil || password == nil {
+			return nil
+		}
+		return &githttp.BasicAuth{
+			Username: *login,
+			Password: *password,
+		}
+	case "ssh":
+		if e.sshKey == "" {
+			return nil
+		}
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		a, err := gitssh.NewPublicKeysFromFile(user, e.sshKey, "")
+		if err != nil {
+			log.WithError(err).WithField("key", e.sshKey).Warn("unable to read ssh key")
+			return nil
+		}
+		return a
+	}
+	return nil
+}
+
+// sparseDirs returns the path prefixes checked out for a sparse repo,
+// or nil for a full checkout
+func (e *goGit) sparseDirs(repo *Repo) []string {
+	if !repo.Sparse {
+		return nil
+	}
+	var dirs []string
+	for _, p := range repo.SparsePaths() {
+		dirs = append(dirs, p+"/")
+	}
+	if len(repo.Namespaces) > 0 {
+		// keep the docs index, as a cone mode checkout with git would
+		dirs = append(dirs, "docs/README.md")
+	}
+	return dirs
+}
+
+func (e *goGit) Clone(ctx context.Context, repo *Repo, dir string) error {
+	l := log.WithFields(log.Fields{
+		"fn":  "goGit.Clone",
+		"dir": dir,
+	})
+	l.Debug("cloning repo")
+	r, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:           repo.URL,
+		Auth:          e.auth(repo.URL),
+		ReferenceName: plumbing.NewBranchReferenceName(repo.Branch),
+		SingleBranch:  true,
+		Depth:         repo.Depth,
+	})
+	if err == nil {
+		err = e.sparse(r, dir, e.sparseDirs(repo))
+	}
+	if err != nil {
+		// don't leave a partial clone behind, it would be mistaken for a checkout
+		os.RemoveAll(dir)
+		return e.error("clone", dir, err)
+	}
+	return nil
+}
+
+func (e *goGit) Pull(ctx context.Context, repo *Repo, dir string) error {
+	l := log.WithFields(log.Fields{
+		"fn":  "goGit.Pull",
+		"dir": dir,
+	})
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return e.error("open", dir, err)
+	}
+	l.Debug("fetching")
+	remoteName := plumbing.NewRemoteReferenceName("origin", repo.Branch)
+	err = r.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(repo.Branch), remoteName)),
+		},
+		Auth:  e.auth(repo.URL),
+		Force: true,
+		Depth: repo.Depth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return e.error("fetch", dir, err)
+	}
+	remote, err := r.Reference(remoteName, true)
+	if err != nil {
+		return e.error("fetch", dir, err)
+	}
+	// point the local branch at origin, check it out, and hard reset to it
+	l.WithField("commit", remote.Hash().String()).Debug("resetting")
+	branch := plumbing.NewHashReference(plumbing.NewBranchReferenceName(repo.Branch), remote.Hash())
+	if err := r.Storer.SetReference(branch); err != nil {
+		return e.error("checkout", dir, err)
+	}
+	if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch.Name())); err != nil {
+		return e.error("checkout", dir, err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return e.error("reset", dir, err)
+	}
+	// reset the full tree, then remove anything outside of the sparse paths
+	if err := e.clearSkipWorktree(r); err != nil {
+		return e.error("reset", dir, err)
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset}); err != nil {
+		return e.error("reset", dir, err)
+	}
+	if err := e.sparse(r, dir, e.sparseDirs(repo)); err != nil {
+		return e.error("sparse-checkout", dir, err)
+	}
+	// go-git does not write FETCH_HEAD, which is used to track when we last updated
+	fetchHead := fmt.Sprintf("%s\t\tbranch '%s' of %s\n", remote.Hash(), repo.Branch, repo.URL)
+	if err := os.WriteFile(filepath.Join(dir, ".git", "FETCH_HEAD"), []byte(fetchHead), 0644); err != nil {
+		return e.error("fetch", dir, err)
+	}
+	return nil
+}
+
+// sparse marks every file outside of dirs as skipped, and removes it
+// from the worktree. go-git has no partial clone support, so unlike the
+// exec backend the skipped files are still fetched.
+func (e *goGit) sparse(r *git.Repository, dir string, dirs []string) error {
+	if dirs == nil {
+		return nil
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for _, entry := range idx.Entries {
+		if inSparseDirs(entry.Name, dirs) {
+			continue
+		}
+		entry.SkipWorktree = true
+		f := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if err := os.RemoveAll(f); err != nil {
+			return err
+		}
+		// clean up any directories left empty
+		for d := filepath.Dir(f); d != dir && strings.HasPrefix(d, dir); d = filepath.Dir(d) {
+			if os.Remove(d) != nil {
+				break
+			}
+		}
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+func (e *goGit) clearSkipWorktree(r *git.Repository) error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, entry := range idx.Entries {
+		if entry.SkipWorktree {
+			entry.SkipWorktree = false
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+func (e *goGit) UpdateSubmodules(ctx context.Context, repo *Repo, dir string) ([]SubmoduleStatus, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, e.error("open", dir, err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, e.error("submodule update", dir, err)
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return nil, e.error("submodule update", dir, err)
+	}
+	sparse := e.sparseDirs(repo)
+	var statuses []SubmoduleStatus
+	for _, s := range subs {
+		if sparse != nil && !inSparseDirs(s.Config().Path, sparse) {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"fn":        "goGit.UpdateSubmodules",
+			"submodule": s.Config().Path,
+		}).Debug("updating submodule")
+		err := s.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			Auth:              e.auth(s.Config().URL),
+			Depth:             repo.Depth,
+		})
+		if ctx.Err() != nil {
+			return statuses, ctx.Err()
+		}
+		status := SubmoduleStatus{
+			Path:    s.Config().Path,
+			URL:     s.Config().URL,
+			Status:  SubmoduleOK,
+			Updated: time.Now(),
+		}
+		if err != nil {
+			status.Status = goSubmoduleStatus(err)
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// goSubmoduleStatus classifies a failed submodule update
+func goSubmoduleStatus(err error) string {
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed):
+		return SubmoduleAuthFailed
+	case errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, plumbing.ErrObjectNotFound),
+		errors.Is(err, plumbing.ErrReferenceNotFound):
+		return SubmoduleMissing
+	}
+	return SubmoduleError
+}
+
+func inSparseDirs(p string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(p+"/", d) || p == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *goGit) remoteRefs(ctx context.Context, repo *Repo) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repo.URL},
+	})
+	return remote.ListContext(ctx, &git.ListOptions{
+		Auth: e.auth(repo.URL),
+	})
+}
+
+func (e *goGit) Checkout(ctx context.Context, repo *Repo, dir string, rev string) error {
+	l := log.WithFields(log.Fields{
+		"fn":  "goGit.Checkout",
+		"dir": dir,
+		"rev": rev,
+	})
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return e.error("open", dir, err)
+	}
+	// work out what to fetch. refs are matched against the remote, and
+	// anything else is assumed to be a commit
+	refs, err := e.remoteRefs(ctx, repo)
+	if err != nil {
+		return e.error("ls-remote", dir, err)
+	}
+	var refspec config.RefSpec
+	for _, ref := range refs {
+		name := ref.Name().String()
+		if name == rev || name == "refs/tags/"+rev || name == "refs/heads/"+rev {
+			refspec = config.RefSpec(fmt.Sprintf("+%s:%s", name, pinnedRef))
+			break
+		}
+	}
+	revision := plumbing.Revision(pinnedRef)
+	if refspec == "" && plumbing.IsHash(rev) {
+		refspec = config.RefSpec(fmt.Sprintf("+%s:%s", rev, pinnedRef))
+	}
+	fetch := func(refspec config.RefSpec, depth int) error {
+		l.WithField("refspec", refspec).Debug("fetching")
+		err := r.FetchContext(ctx, &git.FetchOptions{
+			RemoteName: "origin",
+			RefSpecs:   []config.RefSpec{refspec},
+			Auth:       e.auth(repo.URL),
+			Force:      true,
+			Depth:      depth,
+			Tags:       git.NoTags,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return err
+		}
+		return nil
+	}
+	if refspec != "" {
+		err = fetch(refspec, repo.Depth)
+	}
+	if refspec == "" || errors.Is(err, git.ErrExactSHA1NotSupported) {
+		// an abbreviated commit, or a server which can't fetch commits
+		// directly. fetch the full history of every branch and find it there.
+		revision = plumbing.Revision(rev)
+		err = fetch("+refs/heads/*:refs/remotes/origin/*", 0)
+		if rerr := r.Storer.RemoveReference(pinnedRef); err == nil {
+			err = rerr
+		}
+	}
+	if err != nil {
+		return e.error("fetch", dir, err)
+	}
+	// peel annotated tags to the commit they point at
+	hash, err := r.ResolveRevision(revision)
+	if err != nil {
+		return e.error("fetch", dir, err)
+	}
+	l.WithField("commit", hash.String()).Debug("resetting")
+	if err := e.reset(r, repo, dir, *hash); err != nil {
+		return err
+	}
+	fetchHead := fmt.Sprintf("%s\t\t'%s' of %s\n", hash, rev, repo.URL)
+	if err := os.WriteFile(filepath.Join(dir, ".git", "FETCH_HEAD"), []byte(fetchHead), 0644); err != nil {
+		return e.error("fetch", dir, err)
+	}
+	return nil
+}
+
+// reset hard resets the checkout to hash with a detached HEAD
+func (e *goGit) reset(r *git.Repository, repo *Repo, dir string, hash plumbing.Hash) error {
+	if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash)); err != nil {
+		return e.error("checkout", dir, err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return e.error("reset", dir, err)
+	}
+	if err := e.clearSkipWorktree(r); err != nil {
+		return e.error("reset", dir, err)
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); err != nil {
+		return e.error("reset", dir, err)
+	}
+	if err := e.sparse(r, dir, e.sparseDirs(repo)); err != nil {
+		return e.error("sparse-checkout", dir, err)
+	}
+	return nil
+}
+
+func (e *goGit) Reset(ctx context.Context, repo *Repo, dir string, commit string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return e.error("open", dir, err)
+	}
+	return e.reset(r, repo, dir, plumbing.NewHash(commit))
+}
+
+func (e *goGit) Tags(ctx context.Context, repo *Repo) ([]string, error) {
+	refs, err := e.remoteRefs(ctx, repo)
+	if err != nil {
+		return nil, e.error("ls-remote", "", err)
+	}
+	var tags []string
+	for _, ref := range refs {
+		if ref.Name().IsTag() {
+			tags = append(tags, ref.Name().Short())
+		}
+	}
+	return tags, nil
+}
+
+func (e *goGit) Head(ctx context.Context, dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", e.error("open", dir, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", e.error("rev-parse", dir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+func (e *goGit) Log(ctx context.Context, dir string, path string, limit int) ([]Commit, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, e.error("open", dir, err)
+	}
+	iter, err := r.Log(&git.LogOptions{
+		PathFilter: func(p string) bool {
+			return p == path || strings.HasPrefix(p, path+"/")
+		},
+	})
+	if err != nil {
+		return nil, e.error("log", dir, err)
+	}
+	var commits []Commit
+	err = iter.ForEach(func(c *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		commits = append(commits, Commit{
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			Date:    c.Author.When,
+			Subject: subject,
+		})
+		if limit > 0 && len(commits) >= limit {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, e.error("log", dir, err)
+	}
+	return commits, nil
+}
+
+func (e *goGit) Show(ctx context.Context, dir string, rev string, path string) ([]byte, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, e.error("open", dir, err)
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, e.error("show", dir, err)
+	}
+	c, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, e.error("show", dir, err)
+	}
+	f, err := c.File(path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, e.error("show", dir, fmt.Errorf("%s at %s: %w", path, rev, os.ErrNotExist))
+	} else if err != nil {
+		return nil, e.error("show", dir, err)
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil, e.error("show", dir, err)
+	}
+	return []byte(content), nil
+}
+
+// commitTree returns the tree of the commit rev resolves to
+func (e *goGit) commitTree(r *git.Repository, rev string) (*object.Tree, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+func (e *goGit) Changes(ctx context.Context, dir string, from string, to string, path string) ([]FileChange, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, e.error("open", dir, err)
+	}
+	a, err := e.commitTree(r, from)
+	if err != nil {
+		return nil, e.error("diff", dir, err)
+	}
+	b, err := e.commitTree(r, to)
+	if err != nil {
+		return nil, e.error("diff", dir, err)
+	}
+	diffs, err := object.DiffTreeWithOptions(ctx, a, b, &object.DiffTreeOptions{})
+	if err != nil {
+		return nil, e.error("diff", dir, err)
+	}
+	var changes []FileChange
+	for _, d := range diffs {
+		action, err := d.Action()
+		if err != nil {
+			return nil, e.error("diff", dir, err)
+		}
+		p, change := d.To.Name, FileModified
+		switch action {
+		case merkletrie.Insert:
+			change = FileAdded
+		case merkletrie.Delete:
+			p, change = d.From.Name, FileRemoved
+		}
+		if p != path && !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+		changes = append(changes, FileChange{Path: p, Change: change})
+	}
+	return changes, nil
+}
+
+func (e *goGit) Worktree(ctx context.Context, dir string) (*Worktree, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, e.error("open", dir, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, e.error("status", dir, err)
+	}
+	w := &Worktree{}
+	if head.Name().IsBranch() {
+		w.Branch = head.Name().Short()
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, e.error("status", dir, err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, e.error("status", dir, err)
+	}
+	// files outside of a sparse checkout are missing on purpose
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, e.error("status", dir, err)
+	}
+	skipped := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		if entry.SkipWorktree {
+			skipped[entry.Name] = true
+		}
+	}
+	for p, s := range status {
+		if skipped[p] || s.Staging == git.Unmodified && s.Worktree == git.Unmodified {
+			continue
+		}
+		w.Changed = append(w.Changed, p)
+	}
+	sort.Strings(w.Changed)
+	return w, nil
+}
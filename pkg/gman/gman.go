@@ -1,11 +1,14 @@
 package gman
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -20,23 +23,73 @@ var (
 )
 
 type Gman struct {
-	Repo               *Repo
-	ConfigDir          string
-	LocalDir           string
-	Pager              string
-	UpdateInterval     time.Duration
-	CurrentNamespace   string
-	ForceUpdate        bool
+	Repo             *Repo
+	ConfigDir        string
+	LocalDir         string
+	Pager            string
+	UpdateInterval   time.Duration
+	CurrentNamespace string
+	ForceUpdate      bool
+	// BackgroundUpdate updates the repo in a detached process, rather than
+	// waiting for it, see StartBackgroundUpdate
+	BackgroundUpdate   bool
 	NotifyOnNewRelease bool
-	Render             bool
-	TLDR               bool
+	// Digest shows the apps changed by each update, see PendingDigest
+	Digest bool
+	// DigestNamespaces limits the digest to the given namespaces
+	DigestNamespaces []string
+	Render           bool
+	TLDR             bool
+	// GitBackend selects how git operations are run, see NewGitBackend
+	GitBackend string
+	// Profile is the name of the selected profile, if any
+	Profile string
+	// Auth selects the credentials used to fetch the repo and its pages
+	Auth *Auth
 
 	WebMode bool
 	WebAddr string
 	WebDir  string
+	// WebTLSCert and WebTLSKey enable TLS. Both files are reloaded when they change
+	WebTLSCert string
+	WebTLSKey  string
+	// WebHtpasswd enables HTTP basic auth against an htpasswd file
+	WebHtpasswd string
+	// WebProxyUserHeader trusts a reverse proxy to set the authenticated user
+	WebProxyUserHeader   string
+	WebProxyGroupsHeader string
+	// WebTrustedProxies restricts which addresses may set the proxy
+	// headers. If it is empty, only localhost may
+	WebTrustedProxies []string
+	// LinkCheckInterval is how often the web server checks the repo's
+	// links, see CheckLinks. 0 disables the check
+	LinkCheckInterval time.Duration
+	// LinkCheckExternal requests external links too when checking links
+	LinkCheckExternal bool
+	// LinkCheckDelay is the time between requests to the same host when
+	// checking external links
+	LinkCheckDelay time.Duration
 
-	Apps     map[string][]App
+	// Apps and Releases are copies of the catalog, set each time it is
+	// loaded. They are not updated safely while the web server is running.
+	//
+	// Deprecated: use ListApps, GetApp and ListReleases, or Catalog.
+	Apps map[string][]App
+	// Deprecated: use ListReleases or Catalog.
 	Releases []release.Release
+
+	// config is the merged config, and configSources the layer each key was set in
+	config        *ConfigFile
+	configSources map[string]string
+
+	catalog atomic.Pointer[Catalog]
+	loadMu  sync.Mutex
+
+	webInited bool
+	// linkCheckRunning is set while a scheduled link check is probing external links
+	linkCheckRunning atomic.Bool
+	statusMu         sync.RWMutex
+	status           ServerStatus
 }
 
 type App struct {
@@ -48,53 +101,125 @@ type App struct {
 	ExamplesDir *string `json:"examplesDir" yaml:"examplesDir"`
 }
 
+// Catalog is an immutable snapshot of the apps and releases loaded
+// from the local repo. A new Catalog is built on every load and swapped
+// in whole, so readers always see a consistent view. It must not be modified.
+type Catalog struct {
+	// Apps maps each namespace to its apps, sorted by name
+	Apps map[string][]App
+	// Releases are sorted with the latest release first
+	Releases []release.Release
+	// ACL restricts namespaces in server mode, it is nil if the repo has no ACL file
+	ACL *ACL
+	// index maps each app name to the apps with that name, with the
+	// default namespace first and the rest sorted by namespace
+	index map[string][]App
+}
+
+func newCatalog(apps map[string][]App, releases []release.Release, acl *ACL) *Catalog {
+	c := &Catalog{
+		Apps:     apps,
+		Releases: releases,
+		ACL:      acl,
+		index:    make(map[string][]App),
+	}
+	if c.Apps == nil {
+		c.Apps = make(map[string][]App)
+	}
+	namespaces := make([]string, 0, len(c.Apps))
+	for ns, nsApps := range c.Apps {
+		sort.Slice(nsApps, func(i, j int) bool {
+			return nsApps[i].Name < nsApps[j].Name
+		})
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		if namespaces[i] == "default" || namespaces[j] == "default" {
+			return namespaces[i] == "default"
+		}
+		return namespaces[i] < namespaces[j]
+	})
+	for _, ns := range namespaces {
+		for _, app := range c.Apps[ns] {
+			c.index[app.Name] = append(c.index[app.Name], app)
+		}
+	}
+	return c
+}
+
+// Catalog returns the currently loaded snapshot. It is never nil.
+func (g *Gman) Catalog() *Catalog {
+	c := g.catalog.Load()
+	if c == nil {
+		return newCatalog(nil, nil, nil)
+	}
+	return c
+}
+
+// storeCatalog swaps in c, and copies it to the deprecated Apps and
+// Releases fields. It must be called with loadMu held.
+func (g *Gman) storeCatalog(c *Catalog) {
+	g.catalog.Store(c)
+	apps := make(map[string][]App, len(c.Apps))
+	for ns, nsApps := range c.Apps {
+		apps[ns] = append([]App(nil), nsApps...)
+	}
+	g.Apps = apps
+	g.Releases = append([]release.Release(nil), c.Releases...)
+}
+
 func (g *Gman) ListApps(namespace string) []App {
+	c := g.Catalog()
 	if namespace == "" {
 		var apps []App
-		for _, a := range g.Apps {
+		for _, a := range c.Apps {
 			apps = append(apps, a...)
 		}
 		sort.Slice(apps, func(i, j int) bool {
+			if apps[i].Name == apps[j].Name {
+				return apps[i].Namespace < apps[j].Namespace
+			}
 			return apps[i].Name < apps[j].Name
 		})
 		return apps
 	}
-	// sort by namespace and name
-	sort.Slice(g.Apps[namespace], func(i, j int) bool {
-		return g.Apps[namespace][i].Name < g.Apps[namespace][j].Name
-	})
-	sort.Slice(g.Apps[namespace], func(i, j int) bool {
-		return g.Apps[namespace][i].Namespace < g.Apps[namespace][j].Namespace
-	})
-	return g.Apps[namespace]
+	// return a copy so callers can't modify the snapshot
+	return append([]App(nil), c.Apps[namespace]...)
 }
 
 func (g *Gman) LoadReleases() error {
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+	rs, err := g.readReleases()
+	if err != nil {
+		return err
+	}
+	c := g.Catalog()
+	g.storeCatalog(newCatalog(c.Apps, rs, c.ACL))
+	return nil
+}
+
+func (g *Gman) readReleases() ([]release.Release, error) {
 	if g.LocalDir == "" {
-		return errors.New("local dir not set")
+		return nil, errors.New("local dir not set")
 	}
 	// ensure local dir exists
 	_, err := os.Stat(g.LocalDir)
 	if os.IsNotExist(err) {
-		return nil
+		return nil, nil
 	}
 	// load releases
 	releaseDir := filepath.Join(g.LocalDir, "releases")
 	// ensure local dir exists
 	_, err = os.Stat(releaseDir)
 	if os.IsNotExist(err) {
-		return nil
+		return nil, nil
 	}
-	rs, err := release.LoadReleases(releaseDir)
-	if err != nil {
-		return err
-	}
-	g.Releases = rs
-	return nil
+	return release.LoadReleases(releaseDir)
 }
 
 func (g *Gman) ListReleases() []release.Release {
-	return g.Releases
+	return append([]release.Release(nil), g.Catalog().Releases...)
 }
 
 func (g *Gman) GetRelease(releaseName string) (*release.Release, error) {
@@ -144,7 +269,7 @@ type AppSearch struct {
 	Error  error
 }
 
-func searchApp(app App, search string) (bool, error) {
+func searchApp(ctx context.Context, app App, search string) (bool, error) {
 	l := log.WithField("fn", "searchApp")
 	l.WithField("app", app.Name).Debug("checking app")
 	if strings.Contains(app.Name, search) {
@@ -153,7 +278,7 @@ func searchApp(app App, search string) (bool, error) {
 	}
 	// check inside the readme
 	if app.ReadmeFile != nil {
-		rd, err := app.Readme()
+		rd, err := app.Readme(ctx)
 		if err != nil {
 			return false, err
 		}
@@ -164,7 +289,7 @@ func searchApp(app App, search string) (bool, error) {
 	}
 	// check inside the tldr
 	if app.ShortFile != nil {
-		tl, err := app.TLDR()
+		tl, err := app.TLDR(ctx)
 		if err != nil {
 			l.WithError(err).Debug("error getting tldr")
 			return false, err
@@ -178,12 +303,18 @@ func searchApp(app App, search string) (bool, error) {
 
 }
 
-func appSearchWorker(jobs chan AppSearch, res chan AppSearch) {
+func appSearchWorker(ctx context.Context, jobs chan AppSearch, res chan AppSearch) {
 	l := log.WithField("fn", "appSearchWorker")
 	l.Debug("starting app search worker")
 	for j := range jobs {
+		// drain the remaining jobs without doing any work once cancelled
+		if err := ctx.Err(); err != nil {
+			j.Error = err
+			res <- j
+			continue
+		}
 		l.WithField("app", j.App.Name).Debug("checking app")
-		m, err := searchApp(j.App, j.Search)
+		m, err := searchApp(ctx, j.App, j.Search)
 		if err != nil {
 			j.Error = err
 			res <- j
@@ -194,7 +325,7 @@ func appSearchWorker(jobs chan AppSearch, res chan AppSearch) {
 	}
 }
 
-func (g *Gman) SearchApps(namespace string, search string) []App {
+func (g *Gman) SearchApps(ctx context.Context, namespace string, search string) []App {
 	l := log.WithField("fn", "SearchApps")
 	l.Debug("searching apps")
 	// Don't open URLs on get failure when searching
@@ -208,7 +339,7 @@ func (g *Gman) SearchApps(namespace string, search string) []App {
 	jobs := make(chan AppSearch, len(apps))
 	res := make(chan AppSearch, len(apps))
 	for w := 1; w <= workers; w++ {
-		go appSearchWorker(jobs, res)
+		go appSearchWorker(ctx, jobs, res)
 	}
 	for _, app := range apps {
 		jobs <- AppSearch{
@@ -220,7 +351,9 @@ func (g *Gman) SearchApps(namespace string, search string) []App {
 	for a := 1; a <= len(apps); a++ {
 		r := <-res
 		if r.Error != nil {
-			l.WithError(r.Error).Error("error searching app")
+			if ctx.Err() == nil {
+				l.WithError(r.Error).Error("error searching app")
+			}
 			continue
 		}
 		if r.Match && !appsSliceContains(foundApps, r.App) {
@@ -228,9 +361,9 @@ func (g *Gman) SearchApps(namespace string, search string) []App {
 		}
 	}
 	// if we found no apps, try across all namespaces
-	if len(foundApps) == 0 && namespace != "" {
+	if len(foundApps) == 0 && namespace != "" && ctx.Err() == nil {
 		l.Debug("no apps found, searching all namespaces")
-		foundApps = g.SearchApps("", search)
+		foundApps = g.SearchApps(ctx, "", search)
 	}
 	l.Debug("apps searched")
 	return foundApps
@@ -243,7 +376,7 @@ type ReleaseSearch struct {
 	Error   error
 }
 
-func searchRelease(r release.Release, search string) (bool, error) {
+func searchRelease(ctx context.Context, r release.Release, search string) (bool, error) {
 	l := log.WithField("fn", "searchRelease")
 	l.WithField("release", r.Name).Debug("checking release")
 	if strings.Contains(r.Name, search) {
@@ -252,7 +385,7 @@ func searchRelease(r release.Release, search string) (bool, error) {
 	}
 	// check inside the readme
 	if r.ReadmeFile != nil {
-		rd, err := r.Readme()
+		rd, err := r.Readme(ctx)
 		if err != nil {
 			return false, err
 		}
@@ -264,12 +397,18 @@ func searchRelease(r release.Release, search string) (bool, error) {
 	return false, nil
 }
 
-func releaseSearchWorker(jobs chan ReleaseSearch, res chan ReleaseSearch) {
+func releaseSearchWorker(ctx context.Context, jobs chan ReleaseSearch, res chan ReleaseSearch) {
 	l := log.WithField("fn", "releaseSearchWorker")
 	l.Debug("starting release search worker")
 	for j := range jobs {
+		// drain the remaining jobs without doing any work once cancelled
+		if err := ctx.Err(); err != nil {
+			j.Error = err
+			res <- j
+			continue
+		}
 		l.WithField("release", j.Release.Name).Debug("checking release")
-		m, err := searchRelease(j.Release, j.Search)
+		m, err := searchRelease(ctx, j.Release, j.Search)
 		if err != nil {
 			j.Error = err
 			res <- j
@@ -280,7 +419,7 @@ func releaseSearchWorker(jobs chan ReleaseSearch, res chan ReleaseSearch) {
 	}
 }
 
-func (g *Gman) SearchReleases(search string) []release.Release {
+func (g *Gman) SearchReleases(ctx context.Context, search string) []release.Release {
 	// Don't open URLs on get failure when searching
 	release.OpenURLOnGetFailure = false
 	var rr []release.Release
@@ -295,7 +434,7 @@ func (g *Gman) SearchReleases(search string) []release.Release {
 	jobs := make(chan ReleaseSearch, len(rs))
 	res := make(chan ReleaseSearch, len(rs))
 	for w := 1; w <= workers; w++ {
-		go releaseSearchWorker(jobs, res)
+		go releaseSearchWorker(ctx, jobs, res)
 	}
 	for _, r := range rs {
 		jobs <- ReleaseSearch{
@@ -307,7 +446,9 @@ func (g *Gman) SearchReleases(search string) []release.Release {
 	for a := 1; a <= len(rs); a++ {
 		r := <-res
 		if r.Error != nil {
-			log.WithError(r.Error).Error("error searching release")
+			if ctx.Err() == nil {
+				log.WithError(r.Error).Error("error searching release")
+			}
 			continue
 		}
 		if r.Match && !releaseSliceContains(rr, r.Release) {
@@ -317,22 +458,56 @@ func (g *Gman) SearchReleases(search string) []release.Release {
 	return rr
 }
 
+// Reload loads apps, releases and the ACL from the local repo and
+// swaps them in as a single snapshot
+func (g *Gman) Reload() error {
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+	apps, err := g.readApps()
+	if err != nil {
+		return err
+	}
+	rs, err := g.readReleases()
+	if err != nil {
+		return err
+	}
+	acl, err := g.readACL()
+	if err != nil {
+		return err
+	}
+	g.storeCatalog(newCatalog(apps, rs, acl))
+	return nil
+}
+
 func (g *Gman) LoadApps() error {
-	l := log.WithField("fn", "LoadApps")
+	g.loadMu.Lock()
+	defer g.loadMu.Unlock()
+	apps, err := g.readApps()
+	if err != nil {
+		return err
+	}
+	acl, err := g.readACL()
+	if err != nil {
+		return err
+	}
+	g.storeCatalog(newCatalog(apps, g.Catalog().Releases, acl))
+	return nil
+}
+
+func (g *Gman) readApps() (map[string][]App, error) {
+	l := log.WithField("fn", "readApps")
 	l.Debug("loading apps")
 	if g.LocalDir == "" {
 		l.Error("local dir not set")
-		return errors.New("local dir not set")
+		return nil, errors.New("local dir not set")
 	}
 	// ensure local dir exists
 	_, err := os.Stat(g.LocalDir)
 	if os.IsNotExist(err) {
 		l.Error("local dir does not exist")
-		return errors.New("local dir does not exist")
-	}
-	if g.Apps == nil {
-		g.Apps = make(map[string][]App)
+		return nil, errors.New("local dir does not exist")
 	}
+	apps := make(map[string][]App)
 	// walk the local dir
 	root := filepath.Join(g.LocalDir, "docs")
 	l.WithField("root", root).Debug("walking local dir")
@@ -342,11 +517,11 @@ func (g *Gman) LoadApps() error {
 			return err
 		}
 
-		// check for the README.md inside the app directory
+		// check for the README.md directly inside the app directory
 		if strings.EqualFold(info.Name(), "README.md") {
 			rel, _ := filepath.Rel(root, path)
 			parts := strings.Split(rel, string(os.PathSeparator))
-			if len(parts) >= 2 {
+			if len(parts) == 3 {
 				namespace := parts[0]
 				appName := parts[1]
 				readmeFile := path
@@ -369,37 +544,31 @@ func (g *Gman) LoadApps() error {
 					ShortFile:   shortFile,
 					ExamplesDir: examplesDir,
 				}
-				g.Apps[namespace] = append(g.Apps[namespace], app)
+				if !appsSliceContains(apps[namespace], app) {
+					apps[namespace] = append(apps[namespace], app)
+				}
 			}
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return nil, err
+	}
+	return apps, nil
 }
 
 func (g *Gman) GetApp(namespace, name string) (*App, error) {
 	l := log.WithField("fn", "GetApp")
 	l.Debug("getting app")
+	c := g.Catalog()
 	if namespace == "" {
 		l.Debug("namespace not set, searching all namespaces")
-		// first, check if the app exists in the default namespace
-		if g.Apps["default"] != nil {
-			for _, app := range g.Apps["default"] {
-				if app.Name == name {
-					l.Debug("app found")
-					return &app, nil
-				}
-			}
-		}
-		l.Debug("app not found in default namespace")
-		// next, check if the app exists in any namespace
-		for _, apps := range g.Apps {
-			for _, app := range apps {
-				if app.Name == name {
-					l.Debug("app found")
-					return &app, nil
-				}
-			}
+		// the index lists the default namespace first, followed by
+		// every other namespace in order
+		if apps := c.index[name]; len(apps) > 0 {
+			l.Debug("app found")
+			app := apps[0]
+			return &app, nil
 		}
 		l.Debug("app not found in any namespace")
 		// app does not exist in any namespace
@@ -407,8 +576,8 @@ func (g *Gman) GetApp(namespace, name string) (*App, error) {
 	}
 	l.Debug("namespace set, searching only in namespace")
 	// explicitly check the namespace for the app
-	for _, app := range g.Apps[namespace] {
-		if app.Name == name {
+	for _, app := range c.index[name] {
+		if app.Namespace == namespace {
 			l.Debug("app found")
 			return &app, nil
 		}
@@ -417,7 +586,7 @@ func (g *Gman) GetApp(namespace, name string) (*App, error) {
 	return nil, errors.New("app not found")
 }
 
-func (a *App) Readme() (string, error) {
+func (a *App) Readme(ctx context.Context) (string, error) {
 	l := log.WithField("fn", "Readme")
 	l.Debug("getting readme")
 	if a.ReadmeFile == nil {
@@ -433,7 +602,7 @@ func (a *App) Readme() (string, error) {
 	l.Debug("readme file read")
 	if utils.IsOnlyUrl(string(b)) {
 		l.Debug("readme file is only a url")
-		res, err := utils.GetRemote(string(b), ServerMode)
+		res, err := utils.GetRemote(ctx, string(b), ServerMode)
 		if err != nil {
 			if OpenURLOnGetFailure {
 				l.Debug("opening url")
@@ -447,7 +616,7 @@ func (a *App) Readme() (string, error) {
 	return string(b), nil
 }
 
-func (a *App) TLDR() (string, error) {
+func (a *App) TLDR(ctx context.Context) (string, error) {
 	if a.ShortFile == nil {
 		return "", errors.New("tldr file not set")
 	}
@@ -457,7 +626,7 @@ func (a *App) TLDR() (string, error) {
 		return "", err
 	}
 	if utils.IsOnlyUrl(string(b)) {
-		res, err := utils.GetRemote(string(b), ServerMode)
+		res, err := utils.GetRemote(ctx, string(b), ServerMode)
 		if err != nil {
 			if OpenURLOnGetFailure {
 				utils.OpenURL(string(b))
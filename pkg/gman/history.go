@@ -0,0 +1,132 @@
+package gman
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// revDateLayouts are the formats accepted for a date in place of a rev.
+// Times without a zone are local.
+var revDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// appPath returns the app's directory relative to the root of the repo
+func (g *Gman) appPath(app *App) (string, error) {
+	rel, err := filepath.Rel(g.LocalDir, app.Dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// AppLog returns the commits which changed the app, newest first
+func (g *Gman) AppLog(ctx context.Context, app *App) ([]Commit, error) {
+	return g.appLog(ctx, app, 0)
+}
+
+// appLog returns at most limit commits which changed the app, or all of them if limit is 0
+func (g *Gman) appLog(ctx context.Context, app *App, limit int) ([]Commit, error) {
+	b, err := g.git()
+	if err != nil {
+		return nil, err
+	}
+	p, err := g.appPath(app)
+	if err != nil {
+		return nil, err
+	}
+	return b.Log(ctx, g.LocalDir, p, limit)
+}
+
+// lastAppCommit returns the last commit which changed the app, or nil if none has
+func (g *Gman) lastAppCommit(ctx context.Context, app *App) (*Commit, error) {
+	commits, err := g.appLog(ctx, app, 1)
+	if err != nil || len(commits) == 0 {
+		return nil, err
+	}
+	return &commits[0], nil
+}
+
+// ResolveAppRev returns the commit to show the app at. rev is either a
+// commit, or any other git rev, or a date, in which case the app is shown
+// as of the last commit which changed it before then.
+func (g *Gman) ResolveAppRev(ctx context.Context, app *App, rev string) (string, error) {
+	var at time.Time
+	for _, layout := range revDateLayouts {
+		if t, err := time.ParseInLocation(layout, rev, time.Local); err == nil {
+			at = t
+			break
+		}
+	}
+	if at.IsZero() {
+		return rev, nil
+	}
+	commits, err := g.AppLog(ctx, app)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range commits {
+		if !c.Date.After(at) {
+			log.WithFields(log.Fields{
+				"fn":     "ResolveAppRev",
+				"date":   at,
+				"commit": c.Hash,
+			}).Debug("resolved date")
+			return c.Hash, nil
+		}
+	}
+	return "", fmt.Errorf("%s/%s did not exist at %s", app.Namespace, app.Name, rev)
+}
+
+// appFileAt returns the contents of a file in the app's directory at rev,
+// fetching it if it only contains a URL, as the current page would be
+func (g *Gman) appFileAt(ctx context.Context, app *App, rev string, name string) (string, error) {
+	b, err := g.git()
+	if err != nil {
+		return "", err
+	}
+	p, err := g.appPath(app)
+	if err != nil {
+		return "", err
+	}
+	data, err := b.Show(ctx, g.LocalDir, rev, path.Join(p, name))
+	if err != nil {
+		return "", err
+	}
+	if utils.IsOnlyUrl(string(data)) {
+		res, err := utils.GetRemote(ctx, string(data), ServerMode)
+		if err != nil {
+			if OpenURLOnGetFailure {
+				utils.OpenURL(string(data))
+			}
+			return string(data), err
+		}
+		data = []byte(res)
+	}
+	return string(data), nil
+}
+
+// ReadmeAt returns the app's README as of rev, see ResolveAppRev
+func (g *Gman) ReadmeAt(ctx context.Context, app *App, rev string) (string, error) {
+	name := "README.md"
+	if app.ReadmeFile != nil {
+		name = filepath.Base(*app.ReadmeFile)
+	}
+	return g.appFileAt(ctx, app, rev, name)
+}
+
+// TLDRAt returns the app's TLDR as of rev, see ResolveAppRev. The error
+// wraps os.ErrNotExist if the app had no TLDR then.
+func (g *Gman) TLDRAt(ctx context.Context, app *App, rev string) (string, error) {
+	return g.appFileAt(ctx, app, rev, "TLDR.md")
+}
@@ -0,0 +1,77 @@
+package gman
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RepoName suggests a name for a repo in the config, from the last
+// element of its URL, eg. docs for https://example.com/org/docs.git
+func RepoName(repoURL string) string {
+	p := repoURL
+	if u, err := url.Parse(repoURL); err == nil && u.Path != "" {
+		p = u.Path
+	} else if _, after, ok := strings.Cut(repoURL, ":"); ok {
+		// scp-like ssh remotes, eg. git@example.com:org/docs.git
+		p = after
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimSuffix(p, "/")), ".git")
+	if name == "" || name == "." || name == "/" {
+		return "default"
+	}
+	return name
+}
+
+// InitRepo checks the repo can be fetched, by cloning it into its local
+// copy, or pulling it if it is already checked out. It is then added to
+// the user's config file as name, and selected as the repo. The config
+// file is left as it was if the repo can't be fetched.
+func (g *Gman) InitRepo(ctx context.Context, name string, repo *Repo) error {
+	l := log.WithFields(log.Fields{
+		"fn":   "InitRepo",
+		"name": name,
+		"repo": repo.URL,
+	})
+	l.Debug("initializing repo")
+	if err := os.MkdirAll(g.ConfigDir, 0755); err != nil {
+		return err
+	}
+	g.Repo = repo
+	dir := g.RepoDir()
+	if dir == "" {
+		return fmt.Errorf("unable to parse repo url %s", repo.URL)
+	}
+	g.LocalDir = filepath.Join(g.ConfigDir, dir)
+	_, err := os.Stat(g.LocalDir)
+	existed := err == nil
+	g.ForceUpdate = true
+	if err := g.GitUpdate(ctx); err != nil {
+		if !existed {
+			// don't leave a partial clone behind
+			os.RemoveAll(g.LocalDir)
+		}
+		return fmt.Errorf("unable to fetch %s: %w", repo.URL, err)
+	}
+	file := g.UserConfigFile()
+	for _, kv := range [][2]string{
+		{"repos." + name + ".url", repo.URL},
+		{"repos." + name + ".branch", repo.Branch},
+		{"repo", name},
+	} {
+		if kv[1] == "" {
+			continue
+		}
+		if err := SetConfigValue(file, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	l.WithField("file", file).Debug("repo initialized")
+	return nil
+}
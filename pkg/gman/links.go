@@ -0,0 +1,456 @@
+package gman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
+	"git.shdw.tech/shdw.tech/gman/pkg/release"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// LinkCheckTimeout is how long to wait for an external link to respond
+	LinkCheckTimeout = 15 * time.Second
+	// LinkCheckMaxRetryAfter is the longest an external link check will
+	// wait for a host which is rate limiting it, before giving up on the link
+	LinkCheckMaxRetryAfter = time.Minute
+	// linkCheckHosts is how many hosts are checked at once
+	linkCheckHosts = 8
+)
+
+// Link is a link in a markdown page
+type Link struct {
+	Line   int    `json:"line" yaml:"line"`
+	Target string `json:"target" yaml:"target"`
+}
+
+// BrokenLink is a link which doesn't go anywhere
+type BrokenLink struct {
+	// File is the page the link is in, relative to the root of the repo
+	File   string `json:"file" yaml:"file"`
+	Line   int    `json:"line" yaml:"line"`
+	Target string `json:"target" yaml:"target"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// LinkReport is the result of checking the links in a gman repo
+type LinkReport struct {
+	Checked time.Time `json:"checked" yaml:"checked"`
+	Pages   int       `json:"pages" yaml:"pages"`
+	Links   int       `json:"links" yaml:"links"`
+	// External is the number of external links probed, 0 if they weren't
+	External int          `json:"external" yaml:"external"`
+	Broken   []BrokenLink `json:"broken" yaml:"broken"`
+}
+
+// inlineLink matches inline links and images, eg. [text](target "title")
+var inlineLink = regexp.MustCompile(`!?\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+[^)]*)?\)`)
+
+// refLink matches link reference definitions, eg. [text]: target
+var refLink = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*<?([^\s>]+)>?`)
+
+// autoLink matches autolinks, eg. <https://example.com>
+var autoLink = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+
+// codeSpan matches inline code, which may contain link-like text
+var codeSpan = regexp.MustCompile("`[^`]*`")
+
+// scanMarkdown calls fn with each line of a markdown page which isn't in
+// a code block or the front matter, with any inline code removed
+func scanMarkdown(b []byte, fn func(n int, line string)) {
+	fence := ""
+	frontMatter := false
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case n == 1 && trimmed == "---":
+			frontMatter = true
+			continue
+		case frontMatter:
+			if trimmed == "---" {
+				frontMatter = false
+			}
+			continue
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			continue
+		}
+		fn(n, codeSpan.ReplaceAllString(line, ""))
+	}
+}
+
+// markdownLinks returns the links in a markdown page, skipping any in code
+func markdownLinks(b []byte) []Link {
+	var links []Link
+	scanMarkdown(b, func(n int, line string) {
+		if m := refLink.FindStringSubmatch(line); m != nil {
+			links = append(links, Link{Line: n, Target: m[1]})
+			return
+		}
+		for _, m := range inlineLink.FindAllStringSubmatch(line, -1) {
+			links = append(links, Link{Line: n, Target: m[1]})
+		}
+		for _, m := range autoLink.FindAllStringSubmatch(line, -1) {
+			links = append(links, Link{Line: n, Target: m[1]})
+		}
+	})
+	return links
+}
+
+// atxHeading matches a heading, eg. ## Usage
+var atxHeading = regexp.MustCompile(`^ {0,3}#{1,6}\s+(.*?)(?:\s+#+)?\s*$`)
+
+// headingID matches an explicit heading id, eg. ## Usage {#usage}
+var headingID = regexp.MustCompile(`\s*\{#([^}\s]+)\}$`)
+
+// htmlAnchor matches the id or name of an html element
+var htmlAnchor = regexp.MustCompile(`<[a-zA-Z][^>]*\s(?:id|name)="([^"]+)"`)
+
+// headingLink matches a link in a heading, which is slugged as its text
+var headingLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+
+// headingSlug returns the anchor of a heading, the way GitHub and
+// docusaurus make them: lower case, with spaces as hyphens and other
+// punctuation removed
+func headingSlug(heading string) string {
+	heading = headingLink.ReplaceAllString(heading, "$1")
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// markdownAnchors returns the anchors in a markdown page: its headings,
+// and any html elements with an id or name
+func markdownAnchors(b []byte) map[string]bool {
+	anchors := make(map[string]bool)
+	seen := make(map[string]int)
+	scanMarkdown(b, func(n int, line string) {
+		for _, m := range htmlAnchor.FindAllStringSubmatch(line, -1) {
+			anchors[m[1]] = true
+		}
+		m := atxHeading.FindStringSubmatch(line)
+		if m == nil {
+			return
+		}
+		if id := headingID.FindStringSubmatch(m[1]); id != nil {
+			anchors[id[1]] = true
+			return
+		}
+		slug := headingSlug(m[1])
+		// repeated headings are numbered, eg. usage, usage-1
+		if i := seen[slug]; i > 0 {
+			anchors[fmt.Sprintf("%s-%d", slug, i)] = true
+		} else {
+			anchors[slug] = true
+		}
+		seen[slug]++
+	})
+	return anchors
+}
+
+// isExternalLink reports whether a link goes to another site, eg.
+// https://example.com or mailto:someone@example.com
+func isExternalLink(target string) bool {
+	if strings.HasPrefix(target, "//") {
+		return true
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme != ""
+}
+
+// resolveLink returns the file a relative link in page points to, and its
+// anchor. The file is empty if the link is to an anchor in page itself.
+func resolveLink(page string, target string) (string, string) {
+	target, anchor, _ := strings.Cut(target, "#")
+	target, _, _ = strings.Cut(target, "?")
+	if target == "" {
+		return "", anchor
+	}
+	if p, err := url.PathUnescape(target); err == nil {
+		target = p
+	}
+	return filepath.Join(filepath.Dir(page), filepath.FromSlash(target)), anchor
+}
+
+// localLinks checks relative links and anchors, caching the anchors of
+// each page read
+type localLinks struct {
+	anchors map[string]map[string]bool
+}
+
+// check returns why a relative link in page is broken, or "" if it isn't
+func (c *localLinks) check(page string, target string) string {
+	file, anchor := resolveLink(page, target)
+	if file == "" {
+		file = page
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return "file not found"
+	}
+	// only markdown pages have anchors gman can check
+	if anchor == "" || info.IsDir() || !strings.EqualFold(filepath.Ext(file), ".md") {
+		return ""
+	}
+	if c.anchors == nil {
+		c.anchors = make(map[string]map[string]bool)
+	}
+	anchors, ok := c.anchors[file]
+	if !ok {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err.Error()
+		}
+		anchors = markdownAnchors(b)
+		c.anchors[file] = anchors
+	}
+	if p, err := url.PathUnescape(anchor); err == nil {
+		anchor = p
+	}
+	if !anchors[anchor] && !anchors[strings.ToLower(anchor)] {
+		return fmt.Sprintf("anchor #%s not found", anchor)
+	}
+	return ""
+}
+
+// repoPages returns the pages of the apps and releases, sorted
+func repoPages(apps map[string][]App, rs []release.Release) []string {
+	var pages []string
+	for _, nsApps := range apps {
+		for _, app := range nsApps {
+			pages = append(pages, *app.ReadmeFile)
+			if app.ShortFile != nil {
+				pages = append(pages, *app.ShortFile)
+			}
+		}
+	}
+	for _, r := range rs {
+		if r.ReadmeFile != nil {
+			pages = append(pages, *r.ReadmeFile)
+		}
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// externalLink is an external link, and each place it is linked from
+type externalLink struct {
+	url   string
+	from  []BrokenLink
+	host  string
+	error string
+}
+
+// checkLocalLinks checks the relative links and anchors in every page of
+// the repo in LocalDir, and returns the external links to probe, if any
+func (g *Gman) checkLocalLinks() (*LinkReport, []*externalLink, error) {
+	apps, err := g.readApps()
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, err := g.readReleases()
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &LinkReport{Checked: time.Now(), Broken: []BrokenLink{}}
+	external := make(map[string]*externalLink)
+	var order []*externalLink
+	local := &localLinks{}
+	for _, page := range repoPages(apps, rs) {
+		b, err := os.ReadFile(page)
+		if err != nil {
+			return nil, nil, err
+		}
+		if utils.IsOnlyUrl(string(b)) {
+			// pages which are only a url are checked by gman lint
+			continue
+		}
+		report.Pages++
+		rel, _ := filepath.Rel(g.LocalDir, page)
+		rel = filepath.ToSlash(rel)
+		for _, link := range markdownLinks(b) {
+			report.Links++
+			at := BrokenLink{File: rel, Line: link.Line, Target: link.Target}
+			if isExternalLink(link.Target) {
+				u, err := url.Parse(link.Target)
+				if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+					continue
+				}
+				e := external[link.Target]
+				if e == nil {
+					e = &externalLink{url: link.Target, host: u.Host}
+					external[link.Target] = e
+					order = append(order, e)
+				}
+				e.from = append(e.from, at)
+				continue
+			}
+			// site absolute links depend on where the docs are served
+			if strings.HasPrefix(link.Target, "/") {
+				continue
+			}
+			if reason := local.check(page, link.Target); reason != "" {
+				at.Reason = reason
+				report.Broken = append(report.Broken, at)
+			}
+		}
+	}
+	return report, order, nil
+}
+
+// CheckLinks checks the links in every README, TLDR and release note of
+// the repo in LocalDir: that relative links go to a file which exists, and
+// that anchors are in the page they link to. If external is set, external
+// links are requested too, and are broken if they return an error.
+func (g *Gman) CheckLinks(ctx context.Context, external bool) (*LinkReport, error) {
+	report, links, err := g.checkLocalLinks()
+	if err != nil {
+		return nil, err
+	}
+	if external {
+		g.probeLinks(ctx, report, links)
+	}
+	sortBrokenLinks(report.Broken)
+	return report, nil
+}
+
+func sortBrokenLinks(broken []BrokenLink) {
+	sort.SliceStable(broken, func(i, j int) bool {
+		if broken[i].File == broken[j].File {
+			return broken[i].Line < broken[j].Line
+		}
+		return broken[i].File < broken[j].File
+	})
+}
+
+// probeLinks requests each external link with HEAD, falling back to GET
+// if the server doesn't support it, adding the broken links to the
+// report. Each host is probed one link at a time, LinkCheckDelay apart,
+// and is waited for if it asks gman to slow down.
+func (g *Gman) probeLinks(ctx context.Context, report *LinkReport, links []*externalLink) {
+	byHost := make(map[string][]*externalLink)
+	var hosts []string
+	for _, e := range links {
+		if byHost[e.host] == nil {
+			hosts = append(hosts, e.host)
+		}
+		byHost[e.host] = append(byHost[e.host], e)
+	}
+	c := &http.Client{Timeout: LinkCheckTimeout}
+	sem := make(chan struct{}, linkCheckHosts)
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(links []*externalLink) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for i, e := range links {
+				if i > 0 && g.LinkCheckDelay > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(g.LinkCheckDelay):
+					}
+				}
+				e.error = probeLink(ctx, c, e.url)
+			}
+		}(byHost[host])
+	}
+	wg.Wait()
+	for _, e := range links {
+		report.External++
+		if e.error == "" {
+			continue
+		}
+		for _, at := range e.from {
+			at.Reason = e.error
+			report.Broken = append(report.Broken, at)
+		}
+	}
+}
+
+// probeLink returns why an external link is broken, or "" if it isn't
+func probeLink(ctx context.Context, c *http.Client, u string) string {
+	l := log.WithFields(log.Fields{
+		"fn":  "probeLink",
+		"url": u,
+	})
+	status, err := linkStatus(ctx, c, http.MethodHead, u)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = linkStatus(ctx, c, http.MethodGet, u)
+	}
+	if err != nil {
+		l.WithError(err).Debug("link check failed")
+		if ctx.Err() != nil {
+			return "not checked: " + ctx.Err().Error()
+		}
+		return err.Error()
+	}
+	l.WithField("status", status).Debug("link checked")
+	if status >= 400 {
+		return fmt.Sprintf("HTTP %d %s", status, http.StatusText(status))
+	}
+	return ""
+}
+
+// linkStatus requests u, with the credentials for its host if there are
+// any, and returns the status code. A 429 or 503 with a Retry-After of up
+// to LinkCheckMaxRetryAfter is retried once it has passed.
+func linkStatus(ctx context.Context, c *http.Client, method string, u string) (int, error) {
+	for retried := false; ; retried = true {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return 0, err
+		}
+		// authenticate the same way pages which are only a url are fetched
+		if _, token := utils.AuthForDomain(req.URL.Hostname()); token != nil {
+			req.Header.Add("Authorization", "token "+*token)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		if retried || res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable {
+			return res.StatusCode, nil
+		}
+		wait, err := strconv.Atoi(res.Header.Get("Retry-After"))
+		if err != nil || time.Duration(wait)*time.Second > LinkCheckMaxRetryAfter {
+			return res.StatusCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(wait) * time.Second):
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package gman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.shdw.tech/shdw.tech/gman/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// LintError is a problem users will run into, such as a missing page
+	LintError = "error"
+	// LintWarning is a problem which may be intended, but likely isn't
+	LintWarning = "warning"
+)
+
+// LintProblem is a problem found in a gman repo
+type LintProblem struct {
+	// File is relative to the root of the repo
+	File string `json:"file" yaml:"file"`
+	// Line is 0 if the problem isn't on a particular line
+	Line int `json:"line,omitempty" yaml:"line,omitempty"`
+	// Severity is LintError or LintWarning
+	Severity string `json:"severity" yaml:"severity"`
+	// Rule names the check which found the problem, eg. broken-link
+	Rule    string `json:"rule" yaml:"rule"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (p LintProblem) String() string {
+	loc := p.File
+	if p.Line > 0 {
+		loc = fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", loc, p.Severity, p.Message, p.Rule)
+}
+
+// linter collects the problems found in the repo at dir
+type linter struct {
+	dir      string
+	links    localLinks
+	problems []LintProblem
+}
+
+func (li *linter) add(file string, line int, severity string, rule string, format string, a ...any) {
+	if rel, err := filepath.Rel(li.dir, file); err == nil {
+		file = rel
+	}
+	li.problems = append(li.problems, LintProblem{
+		File:     filepath.ToSlash(file),
+		Line:     line,
+		Severity: severity,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Lint checks the gman repo checked out in LocalDir, reading it the same
+// way as LoadApps and LoadReleases, for the mistakes users would otherwise
+// find: READMEs which aren't read as apps, empty pages, release versions
+// which don't sort, broken relative links, duplicate app names and, unless
+// offline, pages which are only a URL which can't be fetched.
+func (g *Gman) Lint(ctx context.Context, offline bool) ([]LintProblem, error) {
+	l := log.WithFields(log.Fields{
+		"fn":  "Lint",
+		"dir": g.LocalDir,
+	})
+	l.Debug("linting repo")
+	li := &linter{dir: g.LocalDir}
+	docs := filepath.Join(g.LocalDir, "docs")
+	if _, err := os.Stat(docs); os.IsNotExist(err) {
+		li.add(docs, 0, LintError, "no-docs", "no docs directory, pages are docs/{namespace}/{app}/README.md")
+		return li.problems, nil
+	}
+	apps, err := g.readApps()
+	if err != nil {
+		return nil, err
+	}
+	if err := li.lintReadmeDepth(docs); err != nil {
+		return nil, err
+	}
+	byName := make(map[string][]App)
+	for _, nsApps := range apps {
+		for _, app := range nsApps {
+			byName[app.Name] = append(byName[app.Name], app)
+		}
+	}
+	for name, dups := range byName {
+		if len(dups) < 2 {
+			continue
+		}
+		sort.Slice(dups, func(i, j int) bool { return dups[i].Namespace < dups[j].Namespace })
+		var ns []string
+		for _, app := range dups {
+			ns = append(ns, app.Namespace)
+		}
+		for _, app := range dups {
+			li.add(*app.ReadmeFile, 0, LintWarning, "duplicate-app", "app %s is in several namespaces: %s", name, strings.Join(ns, ", "))
+		}
+	}
+	rs, err := g.readReleases()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		if !semver.IsValid(r.Name) {
+			li.add(r.Dir, 0, LintError, "release-version", "release %q is not a semantic version, eg. v1.2.0, so can't be sorted", r.Name)
+		}
+	}
+	for _, page := range repoPages(apps, rs) {
+		if err := li.lintPage(ctx, page, offline); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(li.problems, func(i, j int) bool {
+		if li.problems[i].File == li.problems[j].File {
+			return li.problems[i].Line < li.problems[j].Line
+		}
+		return li.problems[i].File < li.problems[j].File
+	})
+	l.WithField("problems", len(li.problems)).Debug("linted repo")
+	return li.problems, nil
+}
+
+// lintReadmeDepth finds READMEs in docs which aren't read as apps. Apps
+// are docs/{namespace}/{app}/README.md, and anything below an app, such as
+// its examples, is part of the app.
+func (li *linter) lintReadmeDepth(docs string) error {
+	return filepath.Walk(docs, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.EqualFold(info.Name(), "README.md") {
+			return err
+		}
+		rel, _ := filepath.Rel(docs, path)
+		parts := strings.Split(rel, string(os.PathSeparator))
+		switch {
+		case len(parts) == 2:
+			li.add(path, 0, LintWarning, "readme-depth", "README.md in a namespace is not read, pages are docs/{namespace}/{app}/README.md")
+		case len(parts) > 3:
+			app := filepath.Join(docs, parts[0], parts[1])
+			if _, err := os.Stat(filepath.Join(app, info.Name())); err == nil {
+				return nil
+			}
+			li.add(path, 0, LintError, "readme-depth", "README.md is too deep to be read as an app, move it to docs/%s/%s/README.md", parts[0], parts[1])
+		}
+		return nil
+	})
+}
+
+// lintPage checks a page is not empty, and its links work
+func (li *linter) lintPage(ctx context.Context, page string, offline bool) error {
+	b, err := os.ReadFile(page)
+	if err != nil {
+		return err
+	}
+	rule := "empty-page"
+	if strings.EqualFold(filepath.Base(page), "TLDR.md") {
+		rule = "empty-tldr"
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		li.add(page, 0, LintError, rule, "%s is empty", filepath.Base(page))
+		return nil
+	}
+	if utils.IsOnlyUrl(string(b)) {
+		if offline {
+			return nil
+		}
+		u := strings.TrimSpace(string(b))
+		if _, err := utils.GetRemote(ctx, u, false); err != nil {
+			li.add(page, 1, LintError, "dead-url", "page is only the url %s, which can't be fetched: %v", u, err)
+		}
+		return nil
+	}
+	for _, link := range markdownLinks(b) {
+		if isExternalLink(link.Target) || strings.HasPrefix(link.Target, "/") {
+			continue
+		}
+		if reason := li.links.check(page, link.Target); reason != "" {
+			li.add(page, link.Line, LintError, "broken-link", "link to %s is broken: %s", link.Target, reason)
+		}
+	}
+	return nil
+}
+
+// LintFailed reports whether any of the problems are at least as severe as
+// severity, LintError or LintWarning
+func LintFailed(problems []LintProblem, severity string) bool {
+	for _, p := range problems {
+		if p.Severity == LintError || severity == LintWarning {
+			return true
+		}
+	}
+	return false
+}
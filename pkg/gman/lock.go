@@ -0,0 +1,111 @@
+package gman
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// UpdateLockTimeout is how long to wait for another process to finish
+	// updating the repo before reading the checkout anyway, or to finish
+	// reading it before putting off an update
+	UpdateLockTimeout = 30 * time.Second
+
+	errLocked = errors.New("locked")
+)
+
+// lockPollInterval is how often a blocked lock is retried
+const lockPollInterval = 100 * time.Millisecond
+
+// repoLock is held on a lock file, usually that of a checkout. Updates hold it
+// exclusively, and readers share it while they read the checkout, so it
+// isn't updated under them.
+type repoLock struct {
+	f *os.File
+}
+
+// lockFile is next to the checkout, so it exists before the first clone
+// and isn't removed with the checkout
+func (g *Gman) lockFile() string {
+	return g.LocalDir + ".lock"
+}
+
+// tryLockRepo takes the repo lock without waiting, returning errLocked
+// if another process holds it
+func (g *Gman) tryLockRepo(exclusive bool) (*repoLock, error) {
+	return tryLockPath(g.lockFile(), exclusive)
+}
+
+// lockRepo waits for the repo lock until ctx is done
+func (g *Gman) lockRepo(ctx context.Context, exclusive bool) (*repoLock, error) {
+	return lockPath(ctx, g.lockFile(), exclusive)
+}
+
+// tryLockPath locks the file f, creating it if needed, without waiting,
+// returning errLocked if another process holds it
+func tryLockPath(f string, exclusive bool) (*repoLock, error) {
+	if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+		return nil, err
+	}
+	fd, err := os.OpenFile(f, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLockFile(fd, exclusive); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &repoLock{f: fd}, nil
+}
+
+// lockPath waits for the lock on the file f until ctx is done
+func lockPath(ctx context.Context, f string, exclusive bool) (*repoLock, error) {
+	for {
+		lock, err := tryLockPath(f, exclusive)
+		if !errors.Is(err, errLocked) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (l *repoLock) unlock() {
+	if err := unlockFile(l.f); err != nil {
+		log.WithError(err).Debug("error unlocking repo")
+	}
+	l.f.Close()
+}
+
+// LockForRead waits for any update in progress in another process to
+// finish, and holds a shared lock on the checkout so it isn't updated
+// while it is read, until the returned func is called. After
+// UpdateLockTimeout, the checkout is read as is, without the lock.
+// The returned func may be called more than once.
+func (g *Gman) LockForRead(ctx context.Context) func() {
+	l := log.WithField("fn", "LockForRead")
+	lock, err := g.tryLockRepo(false)
+	if errors.Is(err, errLocked) {
+		l.Info("waiting for another gman process to finish updating the repo")
+		wctx, cancel := context.WithTimeout(ctx, UpdateLockTimeout)
+		defer cancel()
+		lock, err = g.lockRepo(wctx, false)
+	}
+	if err != nil {
+		l.WithError(err).Warn("unable to wait for repo update, reading current checkout")
+		return func() {}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(lock.unlock)
+	}
+}
@@ -0,0 +1,136 @@
+package gman
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fhs/go-netrc/netrc"
+)
+
+// Auth selects the credentials used to fetch a repo and its pages
+type Auth struct {
+	// Netrc is a netrc file of credentials for http(s) remotes and pages,
+	// used instead of ~/.netrc
+	Netrc string `json:"netrc,omitempty" yaml:"netrc,omitempty"`
+	// SSHKey is a private key for ssh remotes, used instead of the ssh
+	// agent and default keys
+	SSHKey string `json:"sshKey,omitempty" yaml:"sshKey,omitempty"`
+}
+
+func (a Auth) String() string {
+	var s []string
+	if a.Netrc != "" {
+		s = append(s, "netrc="+a.Netrc)
+	}
+	if a.SSHKey != "" {
+		s = append(s, "sshKey="+a.SSHKey)
+	}
+	return strings.Join(s, ", ")
+}
+
+// configPath resolves a file named in the config relative to the config dir
+func configPath(configDir string, f string) string {
+	if f == "" || filepath.IsAbs(f) {
+		return f
+	}
+	if strings.HasPrefix(f, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, f[2:])
+		}
+	}
+	return filepath.Join(configDir, f)
+}
+
+// resolve returns a copy of the auth with its files resolved relative to
+// the config dir
+func (a *Auth) resolve(configDir string) *Auth {
+	if a == nil {
+		return nil
+	}
+	return &Auth{
+		Netrc:  configPath(configDir, a.Netrc),
+		SSHKey: configPath(configDir, a.SSHKey),
+	}
+}
+
+// shellQuote quotes s as a single shell word, as git runs GIT_SSH_COMMAND with the shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// gitEnv returns the environment which makes the git binary use the
+// credentials. The netrc file's credentials are passed as http headers
+// scoped to each machine in it, as git only reads ~/.netrc itself.
+func (a *Auth) gitEnv() ([]string, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var env []string
+	if a.SSHKey != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(a.SSHKey)+" -o IdentitiesOnly=yes")
+	}
+	if a.Netrc == "" {
+		return env, nil
+	}
+	machines, _, err := netrc.ParseFile(a.Netrc)
+	if err != nil {
+		return nil, fmt.Errorf("reading netrc %s: %w", a.Netrc, err)
+	}
+	// keep any config already passed in the environment
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	start := n
+	for _, m := range machines {
+		// the default machine would send the credentials to every host
+		if m.Name == "" || m.Login == "" {
+			continue
+		}
+		header := "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(m.Login+":"+m.Password))
+		for _, scheme := range []string{"https", "http"} {
+			env = append(env,
+				fmt.Sprintf("GIT_CONFIG_KEY_%d=http.%s://%s/.extraHeader", n, scheme, m.Name),
+				fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n, header),
+			)
+			n++
+		}
+	}
+	if n > start {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n))
+	}
+	return env, nil
+}
+
+// selectProfile returns the layer of the profile selected in config, or nil
+func selectProfile(config *ConfigFile) (*configLayer, error) {
+	if config.Profile == nil || *config.Profile == "" {
+		return nil, nil
+	}
+	name := *config.Profile
+	p := config.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("unknown profile %q, must be one of: %s", name, strings.Join(ProfileNames(config), ", "))
+	}
+	return &configLayer{name: ConfigProfile, profile: name, config: p}, nil
+}
+
+// ProfileNames returns the names of the profiles in config, sorted
+func ProfileNames(config *ConfigFile) []string {
+	var names []string
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Profiles returns the names of the profiles in the loaded config
+func (g *Gman) Profiles() []string {
+	if g.config == nil {
+		return nil
+	}
+	return ProfileNames(g.config)
+}
@@ -0,0 +1,29 @@
+package gman
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	for _, s := range []string{
+		"/home/user/.ssh/id_ed25519",
+		"/path with spaces/key",
+		"/it's/key",
+		"/x'; touch /tmp/pwned; echo '",
+		`/$HOME/"key"\`,
+		"",
+	} {
+		out, err := exec.Command(sh, "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh -c with %q: %v", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("shellQuote(%q) was read by the shell as %q", s, out)
+		}
+	}
+}
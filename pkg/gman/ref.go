@@ -0,0 +1,214 @@
+package gman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+// refFile records the pin and the ref it resolved to on the last update,
+// relative to the root of the checkout
+const refFile = ".git/gman-ref.json"
+
+// ActiveRef is the ref the local checkout was last updated to
+type ActiveRef struct {
+	// Pin is the repo setting the ref was resolved from, eg. "tag v2.x"
+	Pin string `json:"pin" yaml:"pin"`
+	// Ref is the branch, tag or commit checked out
+	Ref string `json:"ref" yaml:"ref"`
+}
+
+// RepoStatus reports the state of the local checkout
+type RepoStatus struct {
+	URL         string    `json:"url" yaml:"url"`
+	Dir         string    `json:"dir" yaml:"dir"`
+	Branch      string    `json:"branch" yaml:"branch"`
+	Pin         string    `json:"pin,omitempty" yaml:"pin,omitempty"`
+	Ref         string    `json:"ref" yaml:"ref"`
+	Commit      string    `json:"commit" yaml:"commit"`
+	LastUpdated time.Time `json:"lastUpdated" yaml:"lastUpdated"`
+	// Submodules is the status of each submodule as of the last update
+	Submodules []SubmoduleStatus `json:"submodules,omitempty" yaml:"submodules,omitempty"`
+}
+
+// Pinned reports whether the repo follows a ref, tag or commit rather than its branch
+func (r *Repo) Pinned() bool {
+	return r.Ref != "" || r.Tag != "" || r.Commit != ""
+}
+
+// pin describes the ref the repo is pinned to. Commit takes precedence
+// over Tag, which takes precedence over Ref.
+func (r *Repo) pin() string {
+	switch {
+	case r.Commit != "":
+		return "commit " + r.Commit
+	case r.Tag != "":
+		return "tag " + r.Tag
+	case r.Ref != "":
+		return "ref " + r.Ref
+	}
+	return ""
+}
+
+// isTagConstraint reports whether s selects a tag by version, eg. v2.x,
+// v2.3.x or latest, rather than naming a ref
+func isTagConstraint(s string) bool {
+	if s == "*" || s == "latest" {
+		return true
+	}
+	return strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".*")
+}
+
+// latestTag returns the highest semver tag matching the constraint.
+// Pre-releases are skipped.
+func latestTag(tags []string, constraint string) (string, error) {
+	var want []string
+	if constraint != "*" && constraint != "latest" {
+		c := strings.TrimPrefix(constraint, "v")
+		c = strings.TrimSuffix(strings.TrimSuffix(c, ".x"), ".*")
+		want = strings.Split(c, ".")
+	}
+	var best, bestVersion string
+	for _, tag := range tags {
+		v := tag
+		if !strings.HasPrefix(v, "v") {
+			v = "v" + v
+		}
+		if !semver.IsValid(v) || semver.Prerelease(v) != "" {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(semver.Canonical(v), "v"), ".")
+		if len(want) > len(parts) {
+			continue
+		}
+		match := true
+		for i := range want {
+			if want[i] != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match && (bestVersion == "" || semver.Compare(v, bestVersion) > 0) {
+			best, bestVersion = tag, v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no tag matches %s", constraint)
+	}
+	return best, nil
+}
+
+// resolveRef returns the rev to check out for a pinned repo, resolving
+// tag constraints against the tags on the remote
+func (g *Gman) resolveRef(ctx context.Context, b GitBackend) (string, error) {
+	rev := g.Repo.Commit
+	if rev == "" {
+		rev = g.Repo.Tag
+	}
+	if rev == "" {
+		rev = g.Repo.Ref
+	}
+	if g.Repo.Commit != "" || !isTagConstraint(rev) {
+		return rev, nil
+	}
+	tags, err := b.Tags(ctx, g.Repo)
+	if err != nil {
+		return "", err
+	}
+	tag, err := latestTag(tags, rev)
+	if err != nil {
+		return "", err
+	}
+	log.WithFields(log.Fields{
+		"fn":         "resolveRef",
+		"constraint": rev,
+		"tag":        tag,
+	}).Debug("resolved tag")
+	return tag, nil
+}
+
+// gitCheckout checks out the ref the repo is pinned to, and records it
+func (g *Gman) gitCheckout(ctx context.Context, b GitBackend) error {
+	l := log.WithField("fn", "gitCheckout")
+	rev, err := g.resolveRef(ctx, b)
+	if err != nil {
+		return err
+	}
+	if err := b.Checkout(ctx, g.Repo, g.LocalDir, rev); err != nil {
+		return err
+	}
+	active := ActiveRef{Pin: g.Repo.pin(), Ref: rev}
+	if prev, err := g.ActiveRef(); err != nil || *prev != active {
+		l.Infof("repo pinned to %s, checked out %s", active.Pin, rev)
+	}
+	return g.writeActiveRef(&active)
+}
+
+func (g *Gman) writeActiveRef(a *ActiveRef) error {
+	f := filepath.Join(g.LocalDir, refFile)
+	if a == nil {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f, b, 0644)
+}
+
+// ActiveRef returns the ref the local checkout was last updated to
+func (g *Gman) ActiveRef() (*ActiveRef, error) {
+	b, err := os.ReadFile(filepath.Join(g.LocalDir, refFile))
+	if os.IsNotExist(err) {
+		// following the branch
+		return &ActiveRef{Ref: g.Repo.Branch}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	a := &ActiveRef{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RepoStatus returns the state of the local checkout
+func (g *Gman) RepoStatus(ctx context.Context) (*RepoStatus, error) {
+	b, err := g.git()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := b.Head(ctx, g.LocalDir)
+	if err != nil {
+		return nil, err
+	}
+	active, err := g.ActiveRef()
+	if err != nil {
+		return nil, err
+	}
+	s := &RepoStatus{
+		URL:    g.Repo.URL,
+		Dir:    g.LocalDir,
+		Branch: g.Repo.Branch,
+		Pin:    active.Pin,
+		Ref:    active.Ref,
+		Commit: commit,
+	}
+	if lu, err := g.LastUpdated(); err == nil {
+		s.LastUpdated = lu
+	}
+	if s.Submodules, err = g.SubmoduleStatus(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,234 @@
+package gman
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+// TemplatesDir holds a gman repo's own templates for gman new, relative
+// to the root of the repo. Its app and release directories replace the
+// built-in templates of the same name.
+const TemplatesDir = ".gman/templates"
+
+// builtinTemplates are used when the gman repo has no templates of its own
+//
+//go:embed all:templates
+var builtinTemplates embed.FS
+
+// Scaffold is the data the templates are executed with. Both the
+// contents and the paths of the files are templates.
+type Scaffold struct {
+	// Name is the name of the app, or of the repo's directory
+	Name      string
+	Namespace string
+	// Version is the version of a release
+	Version string
+	// Date is today, eg. 2006-01-02
+	Date string
+}
+
+// templates returns the templates of kind, one of app, release or repo,
+// from the gman repo at root if it has them, or the built-in templates
+func templates(root string, kind string) (fs.FS, error) {
+	if root != "" {
+		dir := filepath.Join(root, TemplatesDir, kind)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			log.WithFields(log.Fields{
+				"fn":  "templates",
+				"dir": dir,
+			}).Debug("using the repo's templates")
+			return os.DirFS(dir), nil
+		}
+	}
+	return fs.Sub(builtinTemplates, path.Join("templates", kind))
+}
+
+// scaffold executes the templates in fsys into dir, and returns the files
+// it created. Nothing is written if any of the files already exist.
+func scaffold(fsys fs.FS, dir string, data Scaffold) ([]string, error) {
+	files := make(map[string][]byte)
+	var order []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := execTemplate(p, []byte(p), data)
+		if err != nil {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		if b, err = execTemplate(p, b, data); err != nil {
+			return err
+		}
+		f := filepath.Join(dir, filepath.FromSlash(string(name)))
+		if _, err := os.Stat(f); err == nil {
+			return fmt.Errorf("%s already exists", f)
+		}
+		files[f] = b
+		order = append(order, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range order {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(f, files[f], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func execTemplate(name string, b []byte, data Scaffold) ([]byte, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("executing template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkName checks name can be used as a single directory in the repo
+func checkName(kind string, name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid %s %q, must be a single directory name", kind, name)
+	}
+	return nil
+}
+
+// ScaffoldRepo creates a new gman repo in dir, with a docs directory, a
+// .gman/config.yaml of defaults for its users, and a copy of the built-in
+// app and release templates in its TemplatesDir, to customize
+func ScaffoldRepo(dir string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range []string{"docs", ".gman"} {
+		if _, err := os.Stat(filepath.Join(dir, existing)); err == nil {
+			return nil, fmt.Errorf("%s is already a gman repo, it has a %s directory", dir, existing)
+		}
+	}
+	data := Scaffold{Name: filepath.Base(abs), Date: time.Now().Format("2006-01-02")}
+	repoTemplates, err := templates("", "repo")
+	if err != nil {
+		return nil, err
+	}
+	created, err := scaffold(repoTemplates, dir, data)
+	if err != nil {
+		return nil, err
+	}
+	// copy the templates as they are, rather than executing them
+	for _, kind := range []string{"app", "release"} {
+		t, err := templates("", kind)
+		if err != nil {
+			return created, err
+		}
+		err = fs.WalkDir(t, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := fs.ReadFile(t, p)
+			if err != nil {
+				return err
+			}
+			f := filepath.Join(dir, TemplatesDir, kind, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+				return err
+			}
+			created = append(created, f)
+			return os.WriteFile(f, b, 0644)
+		})
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// ScaffoldApp creates the page of a new app in the gman repo at root, eg.
+// docs/{namespace}/{name}/README.md, TLDR.md and examples/
+func ScaffoldApp(root string, namespace string, name string) ([]string, error) {
+	if err := checkName("namespace", namespace); err != nil {
+		return nil, err
+	}
+	if err := checkName("app", name); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, "docs", namespace, name)
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("app %s/%s already exists in %s", namespace, name, dir)
+	}
+	t, err := templates(root, "app")
+	if err != nil {
+		return nil, err
+	}
+	return scaffold(t, dir, Scaffold{
+		Name:      name,
+		Namespace: namespace,
+		Date:      time.Now().Format("2006-01-02"),
+	})
+}
+
+// ScaffoldRelease creates the notes of a new release in the gman repo at
+// root, eg. releases/{version}/README.md. The version must be a semantic
+// version, so releases sort in order.
+func ScaffoldRelease(root string, version string) ([]string, error) {
+	if err := checkName("release", version); err != nil {
+		return nil, err
+	}
+	if !semver.IsValid(version) {
+		return nil, fmt.Errorf("invalid release %q, must be a semantic version, eg. v1.2.0", version)
+	}
+	dir := filepath.Join(root, "releases", version)
+	if _, err := os.Stat(dir); err == nil {
+		return nil, fmt.Errorf("release %s already exists in %s", version, dir)
+	}
+	t, err := templates(root, "release")
+	if err != nil {
+		return nil, err
+	}
+	return scaffold(t, dir, Scaffold{
+		Version: version,
+		Date:    time.Now().Format("2006-01-02"),
+	})
+}
+
+// FindRepoRoot returns the root of the gman repo dir is in: the nearest
+// directory, from dir up, with a docs directory or which is a git repo
+func FindRepoRoot(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		for _, marker := range []string{"docs", ".git"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d, nil
+			}
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("%s is not in a gman repo", abs)
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package gman
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,15 +21,137 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func (g *Gman) initWeb() error {
-	// if webdir doesnt exist, create it
-	if _, err := os.Stat(g.WebDir); os.IsNotExist(err) {
-		if err := web.WriteWebContent(g.WebDir); err != nil {
-			return err
+var (
+	// ShutdownTimeout is how long the server waits for in-flight
+	// requests to complete when shutting down
+	ShutdownTimeout = 30 * time.Second
+)
+
+const (
+	// serverRetryMin is the initial delay before retrying a failed update
+	serverRetryMin = 10 * time.Second
+	// serverRetryMax is the longest we will wait between failed updates
+	serverRetryMax = 10 * time.Minute
+)
+
+// ServerStatus reports the state of the web server update loop
+type ServerStatus struct {
+	Ready               bool              `json:"ready" yaml:"ready"`
+	Updating            bool              `json:"updating" yaml:"updating"`
+	Build               string            `json:"build" yaml:"build"`
+	Ref                 string            `json:"ref" yaml:"ref"`
+	Commit              string            `json:"commit" yaml:"commit"`
+	Submodules          []SubmoduleStatus `json:"submodules,omitempty" yaml:"submodules,omitempty"`
+	LastAttempt         time.Time         `json:"lastAttempt" yaml:"lastAttempt"`
+	LastSuccess         time.Time         `json:"lastSuccess" yaml:"lastSuccess"`
+	NextAttempt         time.Time         `json:"nextAttempt" yaml:"nextAttempt"`
+	LastError           string            `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+	ConsecutiveFailures int               `json:"consecutiveFailures" yaml:"consecutiveFailures"`
+	// Links is the result of the last scheduled link check, see LinkCheckInterval
+	Links *LinkReport `json:"links,omitempty" yaml:"links,omitempty"`
+}
+
+// Status returns a copy of the current server status
+func (g *Gman) Status() ServerStatus {
+	g.statusMu.RLock()
+	defer g.statusMu.RUnlock()
+	return g.status
+}
+
+func (g *Gman) updateStatus(fn func(s *ServerStatus)) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+	fn(&g.status)
+}
+
+// siteDir is the docusaurus project written from the embedded content
+func (g *Gman) siteDir() string {
+	return filepath.Join(g.WebDir, "site")
+}
+
+// buildsDir holds each successful build, along with a pointer to the active one
+func (g *Gman) buildsDir() string {
+	return filepath.Join(g.WebDir, "builds")
+}
+
+// currentBuild returns the directory of the build currently being served
+func (g *Gman) currentBuild() string {
+	g.statusMu.RLock()
+	defer g.statusMu.RUnlock()
+	if g.status.Build == "" {
+		return ""
+	}
+	return filepath.Join(g.buildsDir(), g.status.Build)
+}
+
+// loadCurrentBuild restores the last successful build from disk, so
+// there is something to serve while the first update is running
+func (g *Gman) loadCurrentBuild() {
+	l := log.WithField("fn", "loadCurrentBuild")
+	b, err := os.ReadFile(filepath.Join(g.buildsDir(), "current"))
+	if err != nil {
+		l.Debug("no previous build found")
+		return
+	}
+	id := strings.TrimSpace(string(b))
+	if id == "" {
+		return
+	}
+	if _, err := os.Stat(filepath.Join(g.buildsDir(), id)); err != nil {
+		l.WithError(err).Warn("previous build is missing")
+		return
+	}
+	l.WithField("build", id).Info("serving previous build until update completes")
+	g.updateStatus(func(s *ServerStatus) {
+		s.Ready = true
+		s.Build = id
+	})
+}
+
+// swapBuild atomically points the server at a new build and removes any stale builds
+func (g *Gman) swapBuild(id string) error {
+	l := log.WithField("fn", "swapBuild")
+	pointer := filepath.Join(g.buildsDir(), "current")
+	tmp := pointer + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, pointer); err != nil {
+		return err
+	}
+	g.updateStatus(func(s *ServerStatus) {
+		s.Ready = true
+		s.Build = id
+	})
+	// clean up any builds which are no longer served
+	entries, err := os.ReadDir(g.buildsDir())
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == id {
+			continue
+		}
+		l.WithField("build", e.Name()).Debug("removing stale build")
+		if err := os.RemoveAll(filepath.Join(g.buildsDir(), e.Name())); err != nil {
+			l.WithError(err).Warn("error removing stale build")
 		}
 	}
-	cmd := exec.Command("npm", "install")
-	cmd.Dir = g.WebDir
+	return nil
+}
+
+func (g *Gman) initWeb(ctx context.Context) error {
+	// we are going to set the site contents from an embedded
+	// filesystem, so clear out whatever is there now, if anything.
+	// previous builds live outside of the site dir and are left alone
+	if err := os.RemoveAll(g.siteDir()); err != nil {
+		return err
+	}
+	if err := web.WriteWebContent(g.siteDir()); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "npm", "install")
+	cmd.Dir = g.siteDir()
 	if log.GetLevel() >= log.DebugLevel {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -35,11 +163,11 @@ func (g *Gman) initWeb() error {
 	return nil
 }
 
-func (g *Gman) buildWeb() error {
+func (g *Gman) buildWeb(ctx context.Context, docsDir string, outDir string) error {
 	l := log.WithField("fn", "buildWeb")
 	l.Debug("building web")
 	// build the web
-	cmd := exec.Command("npm", "run", "build")
+	cmd := exec.CommandContext(ctx, "npm", "run", "build", "--", "--out-dir", outDir)
 	url, err := url.Parse(g.Repo.URL)
 	if err != nil {
 		return err
@@ -61,12 +189,12 @@ func (g *Gman) buildWeb() error {
 		"NODE_ENV=production",
 		"SITE_TITLE=" + name,
 		"RELEASES_DIR=" + path.Join(g.ConfigDir, g.RepoDir()) + "/releases",
-		"DOCS_DIR=" + path.Join(g.ConfigDir, "web", "docs"),
+		"DOCS_DIR=" + docsDir,
 		"GIT_REPO=" + g.Repo.URL,
 		"GIT_REPO_EDIT_URL=" + editUrl,
 	}...)
 	l.Debugf("env: %v", cmd.Env)
-	cmd.Dir = g.WebDir
+	cmd.Dir = g.siteDir()
 	if log.GetLevel() >= log.DebugLevel {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -79,17 +207,36 @@ func (g *Gman) buildWeb() error {
 	return nil
 }
 
-func (g *Gman) RenderDocsToDisk() error {
-	l := log.WithField("fn", "RenderDocsToDisk")
+func (g *Gman) RenderDocsToDisk(ctx context.Context) error {
+	return g.renderDocsTo(ctx, path.Join(g.ConfigDir, "web", "docs"))
+}
+
+func (g *Gman) renderDocsTo(ctx context.Context, renderedDocsDir string) error {
+	l := log.WithField("fn", "renderDocsTo")
 	l.Debug("rendering docs to disk")
-	// first, create a directory to hold our rendered docs
-	renderedDocsDir := path.Join(g.ConfigDir, "web", "docs")
+	if err := os.MkdirAll(renderedDocsDir, 0755); err != nil {
+		return err
+	}
 	// first, copy over everything as-is
 	if err := utils.Copydir(renderedDocsDir, path.Join(g.LocalDir, "docs")); err != nil {
 		return err
 	}
+	c := g.Catalog()
+	// restricted namespaces are left out of the static site entirely,
+	// and are only served by the access controlled pages
+	if c.ACL != nil {
+		for ns := range c.ACL.Namespaces {
+			l.WithField("namespace", ns).Debug("excluding restricted namespace")
+			if err := os.RemoveAll(filepath.Join(renderedDocsDir, filepath.Clean("/"+ns))); err != nil {
+				return err
+			}
+		}
+	}
 	// next, render the docs
-	for _, apps := range g.Apps {
+	for ns, apps := range c.Apps {
+		if c.ACL.Restricted(ns) {
+			continue
+		}
 		for _, app := range apps {
 			if app.ReadmeFile == nil {
 				continue
@@ -106,7 +253,7 @@ func (g *Gman) RenderDocsToDisk() error {
 					return err
 				}
 				// render the readme
-				rd, err := app.Readme()
+				rd, err := app.Readme(ctx)
 				if err != nil {
 					// just copy the original file as-is
 					if _, err := utils.CopyFile(readmeFile, newReameFile); err != nil {
@@ -130,7 +277,7 @@ func (g *Gman) RenderDocsToDisk() error {
 					return err
 				}
 				// render the tldr
-				tl, err := app.TLDR()
+				tl, err := app.TLDR(ctx)
 				if err != nil {
 					// just copy the original file as-is
 					if _, err := utils.CopyFile(shortfile, newShortFile); err != nil {
@@ -165,58 +312,302 @@ func (g *Gman) RenderDocsToDisk() error {
 	return nil
 }
 
-func (g *Gman) serverUpdater() {
-	l := log.WithField("fn", "serverUpdater")
-	l.Debug("init web")
-	log.Info("initializing node environment...")
-	if err := g.initWeb(); err != nil {
-		l.Fatal(err)
+// serverUpdate pulls the repo and builds a fresh copy of the site. The
+// build is only swapped in once it has completed successfully
+func (g *Gman) serverUpdate(ctx context.Context) error {
+	l := log.WithField("fn", "serverUpdate")
+	l.Debug("updating git")
+	if err := g.GitUpdate(ctx); err != nil {
+		return fmt.Errorf("git update: %w", err)
 	}
-	l.Debug("web inited")
-	for {
-		l.Debug("updating git")
-		if err := g.GitUpdate(); err != nil {
-			l.Fatal(err)
+	if rs, err := g.RepoStatus(ctx); err == nil {
+		g.updateStatus(func(s *ServerStatus) {
+			s.Ref = rs.Ref
+			s.Commit = rs.Commit
+			s.Submodules = rs.Submodules
+		})
+	}
+	l.Debug("loading apps and releases")
+	if err := g.Reload(); err != nil {
+		return fmt.Errorf("load apps: %w", err)
+	}
+	if g.linkCheckDue() {
+		g.startLinkCheck(ctx)
+	}
+	if !g.webInited {
+		log.Info("initializing node environment...")
+		if err := g.initWeb(ctx); err != nil {
+			return fmt.Errorf("init web: %w", err)
 		}
-		l.Debug("loading apps")
-		if err := g.LoadApps(); err != nil {
-			l.Error(err)
+		g.webInited = true
+		l.Debug("web inited")
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	renderDir := filepath.Join(g.WebDir, "render", id)
+	defer os.RemoveAll(renderDir)
+	if err := g.renderDocsTo(ctx, renderDir); err != nil {
+		return fmt.Errorf("render docs: %w", err)
+	}
+	log.Info("building web app...")
+	outDir := filepath.Join(g.buildsDir(), id)
+	if err := g.buildWeb(ctx, renderDir, outDir); err != nil {
+		os.RemoveAll(outDir)
+		return fmt.Errorf("build web: %w", err)
+	}
+	if err := g.swapBuild(id); err != nil {
+		os.RemoveAll(outDir)
+		return fmt.Errorf("swap build: %w", err)
+	}
+	log.Info("web app built, ready to serve")
+	return nil
+}
+
+// linkCheckDue reports whether the scheduled link check should run
+func (g *Gman) linkCheckDue() bool {
+	if g.LinkCheckInterval <= 0 || g.linkCheckRunning.Load() {
+		return false
+	}
+	last := g.Status().Links
+	return last == nil || time.Since(last.Checked) >= g.LinkCheckInterval
+}
+
+// startLinkCheck checks the relative links now, between updates, as the
+// checkout can't change under it, and probes any external links in the
+// background. The report replaces the last one in the status when done.
+func (g *Gman) startLinkCheck(ctx context.Context) {
+	l := log.WithField("fn", "startLinkCheck")
+	report, links, err := g.checkLocalLinks()
+	if err != nil {
+		l.WithError(err).Warn("error checking links")
+		return
+	}
+	g.linkCheckRunning.Store(true)
+	go func() {
+		defer g.linkCheckRunning.Store(false)
+		if g.LinkCheckExternal {
+			g.probeLinks(ctx, report, links)
 		}
-		l.Debug("loading releases")
-		if err := g.LoadReleases(); err != nil {
-			l.Error(err)
+		if ctx.Err() != nil {
+			return
 		}
-		if err := g.RenderDocsToDisk(); err != nil {
-			l.Error(err)
+		sortBrokenLinks(report.Broken)
+		g.updateStatus(func(s *ServerStatus) {
+			s.Links = report
+		})
+		l.WithFields(log.Fields{
+			"links":  report.Links,
+			"broken": len(report.Broken),
+		}).Info("checked links")
+	}()
+}
+
+// serverUpdater keeps the site up to date until ctx is cancelled
+func (g *Gman) serverUpdater(ctx context.Context) {
+	l := log.WithField("fn", "serverUpdater")
+	retry := serverRetryMin
+	for {
+		g.updateStatus(func(s *ServerStatus) {
+			s.Updating = true
+			s.LastAttempt = time.Now()
+		})
+		err := g.serverUpdate(ctx)
+		if ctx.Err() != nil {
+			l.Debug("updater stopped")
+			return
 		}
-		l.Info("building web app...")
-		if err := g.buildWeb(); err != nil {
-			l.Fatal(err)
+		wait := g.UpdateInterval
+		if err != nil {
+			// keep serving the last successful build and try again later
+			l.WithError(err).Errorf("update failed, retrying in %s", retry)
+			wait = retry
+			retry *= 2
+			if retry > serverRetryMax {
+				retry = serverRetryMax
+			}
+			if g.UpdateInterval > 0 && retry > g.UpdateInterval {
+				retry = g.UpdateInterval
+			}
+		} else {
+			retry = serverRetryMin
 		}
-		l.Info("web app built, ready to serve")
+		g.updateStatus(func(s *ServerStatus) {
+			s.Updating = false
+			s.NextAttempt = time.Now().Add(wait)
+			if err != nil {
+				s.LastError = err.Error()
+				s.ConsecutiveFailures++
+				return
+			}
+			s.LastError = ""
+			s.ConsecutiveFailures = 0
+			s.LastSuccess = time.Now()
+		})
 		// sleep
 		l.Debug("sleeping")
-		time.Sleep(g.UpdateInterval)
+		select {
+		case <-ctx.Done():
+			l.Debug("updater stopped")
+			return
+		case <-time.After(wait):
+		}
 	}
 }
 
-func (g *Gman) Server() error {
+// visibleStatus returns the server status, without the details of the
+// namespaces the user of the request may not view
+func (g *Gman) visibleStatus(r *http.Request) ServerStatus {
+	st := g.Status()
+	acl := g.Catalog().ACL
+	u := requestUser(r)
+	var subs []SubmoduleStatus
+	for _, sub := range st.Submodules {
+		if acl.AllowedPath(u, sub.Path) {
+			subs = append(subs, sub)
+		}
+	}
+	st.Submodules = subs
+	if st.Links != nil {
+		// copy the report, which is shared with other requests
+		links := *st.Links
+		links.Broken = []BrokenLink{}
+		for _, b := range st.Links.Broken {
+			if acl.AllowedPath(u, b.File) && (isExternalLink(b.Target) || acl.AllowedPath(u, linkFile(b))) {
+				links.Broken = append(links.Broken, b)
+			}
+		}
+		st.Links = &links
+	}
+	return st
+}
+
+// linkFile returns the file a broken relative link points to, relative to the root of the repo
+func linkFile(b BrokenLink) string {
+	file, _ := resolveLink(b.File, b.Target)
+	return file
+}
+
+func (g *Gman) statusHandler(w http.ResponseWriter, r *http.Request) {
+	st := g.visibleStatus(r)
+	w.Header().Set("Content-Type", "application/json")
+	if !st.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(st); err != nil {
+		log.WithError(err).Error("error writing status")
+	}
+}
+
+// healthHandler reports whether there is a build to serve, without
+// exposing any details, so it can be used by unauthenticated probes
+func (g *Gman) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !g.Status().Ready {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func (g *Gman) staticHandler(w http.ResponseWriter, r *http.Request) {
+	if g.restrictedPath(r) {
+		http.NotFound(w, r)
+		return
+	}
+	dir := g.currentBuild()
+	if dir == "" {
+		http.Error(w, "documentation is being built, please try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+}
+
+// Server serves the docs site until ctx is cancelled, at which point
+// in-flight requests are drained and the updater is stopped
+func (g *Gman) Server(ctx context.Context) error {
+	l := log.WithField("fn", "Server")
 	if g.WebDir == "" {
 		g.WebDir = path.Join(g.ConfigDir, "web")
 	}
-	// we are going to set the webdir contents
-	// from an embedded filesystem, so clear out
-	// whatever is there now, if anything
-	os.RemoveAll(g.WebDir)
+	if err := os.MkdirAll(g.buildsDir(), 0755); err != nil {
+		return err
+	}
 	// don't open the browser on get failure
 	OpenURLOnGetFailure = false
 	// set ServerMode to true
 	ServerMode = true
-	go g.serverUpdater()
-	staticDir := filepath.Join(g.WebDir, "build")
-	http.Handle("/", http.FileServer(http.Dir(staticDir)))
-	log.Infof("server listening on %s", g.WebAddr)
-	if err := http.ListenAndServe(g.WebAddr, nil); err != nil {
+	g.loadCurrentBuild()
+	// serve the existing checkout, if any, until the first update completes
+	if _, err := os.Stat(g.LocalDir); err == nil {
+		if err := g.Reload(); err != nil {
+			l.WithError(err).Warn("error loading existing checkout")
+		}
+	}
+	auth, err := g.newWebAuth()
+	if err != nil {
+		return err
+	}
+	// everything other than the health check requires auth, if configured
+	protected := http.NewServeMux()
+	protected.HandleFunc(apiPrefix+"status", g.statusHandler)
+	protected.HandleFunc(apiPrefix+"api/apps", g.apiAppsHandler)
+	protected.HandleFunc(apiPrefix+"api/search", g.apiSearchHandler)
+	protected.HandleFunc(apiPrefix+"docs/", g.pageHandler)
+	protected.HandleFunc(apiPrefix, g.indexHandler)
+	protected.HandleFunc("/", g.staticHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPrefix+"healthz", g.healthHandler)
+	if auth != nil {
+		mux.Handle("/", auth.middleware(protected))
+	} else {
+		mux.Handle("/", protected)
+	}
+	srv := &http.Server{
+		Addr:    g.WebAddr,
+		Handler: mux,
+	}
+	if g.WebTLSCert != "" || g.WebTLSKey != "" {
+		certs, err := newCertReloader(g.WebTLSCert, g.WebTLSKey)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+	// start updating only once the config has been checked, so an error
+	// above returns before there is an update to wait for
+	updaterCtx, stopUpdater := context.WithCancel(ctx)
+	defer stopUpdater()
+	updaterDone := make(chan struct{})
+	go func() {
+		defer close(updaterDone)
+		g.serverUpdater(updaterCtx)
+	}()
+	errs := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			log.Infof("server listening on %s (tls)", g.WebAddr)
+			errs <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Infof("server listening on %s", g.WebAddr)
+		errs <- srv.ListenAndServe()
+	}()
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		log.Info("shutting down web server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if serr := srv.Shutdown(shutdownCtx); serr != nil {
+			l.WithError(serr).Error("error draining requests")
+		}
+		err = <-errs
+	}
+	// stop the updater, and wait for any running build to be cleaned up
+	stopUpdater()
+	<-updaterDone
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	return nil
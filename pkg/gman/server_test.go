@@ -0,0 +1,121 @@
+package gman
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVisibleStatus(t *testing.T) {
+	g := &Gman{}
+	g.catalog.Store(newCatalog(nil, nil, &ACL{
+		Namespaces: map[string]*NamespaceACL{
+			"secret": {Users: []string{"alice"}},
+		},
+	}))
+	g.updateStatus(func(s *ServerStatus) {
+		s.Submodules = []SubmoduleStatus{
+			{Path: "docs/default/app1", URL: "https://example.com/app1.git", Status: SubmoduleOK},
+			{Path: "docs/secret/app2", URL: "https://example.com/app2.git", Status: SubmoduleError, Error: "denied"},
+			{Path: "vendor/lib", URL: "https://example.com/lib.git", Status: SubmoduleOK},
+		}
+		s.Links = &LinkReport{Broken: []BrokenLink{
+			{File: "docs/default/app1/README.md", Target: "missing.md"},
+			{File: "docs/secret/app2/README.md", Target: "missing.md"},
+			{File: "docs/default/app1/README.md", Target: "../../secret/app3/README.md"},
+			{File: "docs/default/app1/README.md", Target: "https://example.com/secret/"},
+		}}
+	})
+	tests := []struct {
+		name  string
+		user  *User
+		subs  []string
+		links []string
+	}{
+		{
+			name:  "unauthenticated",
+			subs:  []string{"docs/default/app1", "vendor/lib"},
+			links: []string{"missing.md", "https://example.com/secret/"},
+		},
+		{
+			name:  "other user",
+			user:  &User{Name: "bob"},
+			subs:  []string{"docs/default/app1", "vendor/lib"},
+			links: []string{"missing.md", "https://example.com/secret/"},
+		},
+		{
+			name:  "allowed user",
+			user:  &User{Name: "alice"},
+			subs:  []string{"docs/default/app1", "docs/secret/app2", "vendor/lib"},
+			links: []string{"missing.md", "missing.md", "../../secret/app3/README.md", "https://example.com/secret/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/_gman/status", nil)
+			if tt.user != nil {
+				r = r.WithContext(context.WithValue(r.Context(), userContextKey{}, tt.user))
+			}
+			st := g.visibleStatus(r)
+			var subs, links []string
+			for _, s := range st.Submodules {
+				subs = append(subs, s.Path)
+			}
+			for _, b := range st.Links.Broken {
+				links = append(links, b.Target)
+			}
+			if !reflect.DeepEqual(subs, tt.subs) {
+				t.Errorf("submodules = %v, want %v", subs, tt.subs)
+			}
+			if !reflect.DeepEqual(links, tt.links) {
+				t.Errorf("broken links = %v, want %v", links, tt.links)
+			}
+		})
+	}
+	// the shared report must not be modified
+	if n := len(g.Status().Links.Broken); n != 4 {
+		t.Errorf("status has %d broken links, want 4", n)
+	}
+}
+
+func TestAPIHidesLocalPaths(t *testing.T) {
+	dir := t.TempDir()
+	appDir := filepath.Join(dir, "docs", "default", "app1")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"README.md", "TLDR.md"} {
+		if err := os.WriteFile(filepath.Join(appDir, f), []byte("# app1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := &Gman{LocalDir: dir}
+	if err := g.LoadApps(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/_gman/api/apps", g.apiAppsHandler},
+		{"/_gman/api/search?q=app1", g.apiSearchHandler},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			body := w.Body.String()
+			if !strings.Contains(body, `"url":"/_gman/docs/default/app1"`) {
+				t.Errorf("response has no app1 page: %s", body)
+			}
+			if strings.Contains(body, dir) {
+				t.Errorf("response contains the local dir %s: %s", dir, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package gman
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SubmoduleOK is a submodule which was updated
+	SubmoduleOK = "ok"
+	// SubmoduleAuthFailed is a submodule the user has no access to
+	SubmoduleAuthFailed = "auth failure"
+	// SubmoduleMissing is a submodule whose repo or commit no longer exists
+	SubmoduleMissing = "missing"
+	// SubmoduleError is a submodule which failed to update for any other reason
+	SubmoduleError = "error"
+)
+
+// submodulesFile records the result of the last submodule update,
+// relative to the root of the checkout
+const submodulesFile = ".git/gman-submodules.json"
+
+// SubmoduleStatus is the result of updating a single submodule
+type SubmoduleStatus struct {
+	Path    string    `json:"path" yaml:"path"`
+	URL     string    `json:"url" yaml:"url"`
+	Status  string    `json:"status" yaml:"status"`
+	Error   string    `json:"error,omitempty" yaml:"error,omitempty"`
+	Updated time.Time `json:"updated" yaml:"updated"`
+}
+
+func (g *Gman) writeSubmoduleStatus(subs []SubmoduleStatus) error {
+	b, err := json.Marshal(subs)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.LocalDir, submodulesFile), b, 0644)
+}
+
+// SubmoduleStatus returns the result of the last submodule update
+func (g *Gman) SubmoduleStatus() ([]SubmoduleStatus, error) {
+	b, err := os.ReadFile(filepath.Join(g.LocalDir, submodulesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var subs []SubmoduleStatus
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// logSubmodules warns about any submodules which were skipped
+func logSubmodules(subs []SubmoduleStatus) {
+	for _, s := range subs {
+		if s.Status == SubmoduleOK {
+			continue
+		}
+		log.WithFields(log.Fields{
+			"submodule": s.Path,
+			"status":    s.Status,
+		}).Warnf("skipped submodule: %s", s.Error)
+	}
+}
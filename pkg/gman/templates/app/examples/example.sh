@@ -0,0 +1,3 @@
+#!/bin/sh
+# An example of using {{.Name}}
+{{.Name}} --help
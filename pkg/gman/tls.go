@@ -0,0 +1,69 @@
+package gman
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certReloader serves a TLS certificate from disk, reloading it
+// whenever the cert or key file changes
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	// load the certificate up front so a bad config fails on startup
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	certStat, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := os.Stat(c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && certStat.ModTime().Equal(c.certMod) && keyStat.ModTime().Equal(c.keyMod) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	log.WithField("fn", "certReloader").Info("loaded tls certificate")
+	c.cert = &cert
+	c.certMod = certStat.ModTime()
+	c.keyMod = keyStat.ModTime()
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := c.reload(); err != nil {
+		// keep serving the last good certificate, the files may be mid-rotation
+		log.WithField("fn", "certReloader").WithError(err).Error("error reloading tls certificate")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
@@ -0,0 +1,317 @@
+package gman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// verifiedFile records the last commit which passed verification,
+// relative to the root of the checkout
+const verifiedFile = ".git/gman-verified"
+
+// Verify requires the commit, or pinned tag, checked out by each update
+// to be signed by a trusted key
+type Verify struct {
+	// AllowedSigners is a file of trusted ssh keys, in the format of
+	// git's gpg.ssh.allowedSignersFile
+	AllowedSigners string `json:"allowedSigners,omitempty" yaml:"allowedSigners,omitempty"`
+	// GPGKeys is a file of trusted, armored GPG public keys
+	GPGKeys string `json:"gpgKeys,omitempty" yaml:"gpgKeys,omitempty"`
+}
+
+// VerifyError is returned when an update is rejected because it is not
+// signed by a trusted key. The checkout is left at the last verified commit.
+type VerifyError struct {
+	// Commit is the rejected commit
+	Commit string
+	// Verified is the commit checked out instead, if any
+	Verified string
+	Err      error
+}
+
+func (e *VerifyError) Error() string {
+	msg := fmt.Sprintf("rejected unverified commit %s: %v", e.Commit, e.Err)
+	if e.Verified != "" {
+		msg += fmt.Sprintf(", staying on %s", e.Verified)
+	}
+	return msg
+}
+
+func (e *VerifyError) Unwrap() error {
+	return e.Err
+}
+
+// path resolves a key file relative to the config dir
+func (v *Verify) path(configDir string, f string) string {
+	return configPath(configDir, f)
+}
+
+// check verifies a signature over payload, returning the trusted signer
+func (v *Verify) check(configDir string, signature string, payload io.Reader, gpg func(keyring string) (string, error)) (string, error) {
+	switch {
+	case signature == "":
+		return "", errors.New("not signed")
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		if v.AllowedSigners == "" {
+			return "", errors.New("signed with ssh, but no allowedSigners are configured")
+		}
+		signers, err := readAllowedSigners(v.path(configDir, v.AllowedSigners))
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(payload)
+		if err != nil {
+			return "", err
+		}
+		return verifySSHSignature(signers, signature, data)
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"):
+		if v.GPGKeys == "" {
+			return "", errors.New("signed with gpg, but no gpgKeys are configured")
+		}
+		keyring, err := os.ReadFile(v.path(configDir, v.GPGKeys))
+		if err != nil {
+			return "", err
+		}
+		return gpg(string(keyring))
+	}
+	return "", errors.New("unsupported signature type")
+}
+
+// verifyHead checks the signature of the pinned tag, if the checkout is
+// at a tag, otherwise of the commit checked out
+func (g *Gman) verifyHead() (commit string, signer string, err error) {
+	r, err := git.PlainOpen(g.LocalDir)
+	if err != nil {
+		return "", "", err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", "", err
+	}
+	commit = head.Hash().String()
+	v := g.Repo.Verify
+	if g.Repo.Pinned() {
+		if ref, err := r.Reference(pinnedRef, true); err == nil {
+			if tag, err := r.TagObject(ref.Hash()); err == nil {
+				if c, err := tag.Commit(); err == nil && c.Hash == head.Hash() {
+					payload := &plumbing.MemoryObject{}
+					if err := tag.EncodeWithoutSignature(payload); err != nil {
+						return commit, "", err
+					}
+					pr, err := payload.Reader()
+					if err != nil {
+						return commit, "", err
+					}
+					signer, err = v.check(g.ConfigDir, tag.PGPSignature, pr, func(keyring string) (string, error) {
+						e, err := tag.Verify(keyring)
+						if err != nil {
+							return "", err
+						}
+						return gpgIdentity(e.Identities), nil
+					})
+					if err != nil {
+						return commit, "", fmt.Errorf("tag %s: %w", tag.Name, err)
+					}
+					return commit, signer, nil
+				}
+			}
+		}
+	}
+	c, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return commit, "", err
+	}
+	payload := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(payload); err != nil {
+		return commit, "", err
+	}
+	pr, err := payload.Reader()
+	if err != nil {
+		return commit, "", err
+	}
+	signer, err = v.check(g.ConfigDir, c.PGPSignature, pr, func(keyring string) (string, error) {
+		e, err := c.Verify(keyring)
+		if err != nil {
+			return "", err
+		}
+		return gpgIdentity(e.Identities), nil
+	})
+	return commit, signer, err
+}
+
+func gpgIdentity[T any](identities map[string]T) string {
+	for name := range identities {
+		return name
+	}
+	return "unknown"
+}
+
+// lastVerified returns the last commit which passed verification
+func (g *Gman) lastVerified() string {
+	b, err := os.ReadFile(filepath.Join(g.LocalDir, verifiedFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// gitVerify verifies the checkout after an update. If it isn't signed by
+// a trusted key, the checkout is reset to the last verified commit, or
+// removed if there isn't one, so unverified content is never shown.
+func (g *Gman) gitVerify(ctx context.Context, b GitBackend) error {
+	if g.Repo.Verify == nil {
+		return nil
+	}
+	l := log.WithField("fn", "gitVerify")
+	commit, signer, err := g.verifyHead()
+	if err == nil {
+		l.WithFields(log.Fields{
+			"commit": commit,
+			"signer": signer,
+		}).Debug("commit verified")
+		return os.WriteFile(filepath.Join(g.LocalDir, verifiedFile), []byte(commit+"\n"), 0644)
+	}
+	verr := &VerifyError{Commit: commit, Err: err}
+	last := g.lastVerified()
+	if last == "" {
+		l.WithError(err).Error("no verified commit to fall back to, removing checkout")
+		if err := os.RemoveAll(g.LocalDir); err != nil {
+			return err
+		}
+		return verr
+	}
+	if last == commit {
+		// the checkout hasn't moved, but the keys have changed
+		return verr
+	}
+	l.WithError(err).Errorf("resetting to last verified commit %s", last)
+	if err := b.Reset(ctx, g.Repo, g.LocalDir, last); err != nil {
+		return err
+	}
+	if err := g.writeActiveRef(&ActiveRef{Pin: g.Repo.pin(), Ref: last}); err != nil {
+		return err
+	}
+	verr.Verified = last
+	return verr
+}
+
+// allowedSigner is an entry in an ssh allowed signers file
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+	namespaces []string
+}
+
+// readAllowedSigners parses an ssh allowed signers file, see ssh-keygen(1)
+func readAllowedSigners(f string) ([]allowedSigner, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var signers []allowedSigner
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		principals, rest, _ := strings.Cut(line, " ")
+		// the options and key are in the same format as authorized_keys
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", f, n, err)
+		}
+		signer := allowedSigner{principals: principals, key: key}
+		for _, o := range options {
+			if v, ok := strings.CutPrefix(o, "namespaces="); ok {
+				signer.namespaces = strings.Split(strings.Trim(v, `"`), ",")
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, s.Err()
+}
+
+// verifySSHSignature verifies an armored ssh signature, as created by
+// git with gpg.format ssh, and returns the principals of the signer.
+// See PROTOCOL.sshsig in the openssh source for the format.
+func verifySSHSignature(signers []allowedSigner, armored string, data []byte) (string, error) {
+	const magic = "SSHSIG"
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return "", errors.New("invalid ssh signature")
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(magic)) {
+		return "", errors.New("invalid ssh signature")
+	}
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(magic):], &sig); err != nil {
+		return "", fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return "", fmt.Errorf("unsupported ssh signature version %d", sig.Version)
+	}
+	if sig.Namespace != "git" {
+		return "", fmt.Errorf("ssh signature is for namespace %q, not git", sig.Namespace)
+	}
+	pub, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported ssh signature hash %q", sig.HashAlgorithm)
+	}
+	h.Write(data)
+	signed := append([]byte(magic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+	s := &ssh.Signature{}
+	if err := ssh.Unmarshal(sig.Signature, s); err != nil {
+		return "", fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if err := pub.Verify(signed, s); err != nil {
+		return "", err
+	}
+	for _, signer := range signers {
+		if !bytes.Equal(signer.key.Marshal(), pub.Marshal()) {
+			continue
+		}
+		if signer.namespaces != nil && !stringInSlice("git", signer.namespaces) {
+			continue
+		}
+		return signer.principals, nil
+	}
+	return "", fmt.Errorf("signed by untrusted key %s", ssh.FingerprintSHA256(pub))
+}
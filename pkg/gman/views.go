@@ -0,0 +1,130 @@
+package gman
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// viewsFile records when the user last viewed each app, relative to the config dir
+const viewsFile = "views.json"
+
+// View records the last time the user viewed an app
+type View struct {
+	// Commit is the last commit which changed the app when it was viewed
+	Commit string    `json:"commit" yaml:"commit"`
+	Viewed time.Time `json:"viewed" yaml:"viewed"`
+}
+
+// views maps repo URLs to the views of each of their apps, by namespace/name
+type views map[string]map[string]*View
+
+func appKey(app *App) string {
+	return app.Namespace + "/" + app.Name
+}
+
+func (g *Gman) readViews() (views, error) {
+	v := make(views)
+	b, err := os.ReadFile(filepath.Join(g.ConfigDir, viewsFile))
+	if os.IsNotExist(err) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (g *Gman) writeViews(v views) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// replace the file in one go, as other gman processes may read it
+	f := filepath.Join(g.ConfigDir, viewsFile)
+	tmp, err := os.CreateTemp(g.ConfigDir, viewsFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f)
+}
+
+// RecordView records that the user has viewed the app as it is now
+func (g *Gman) RecordView(ctx context.Context, app *App) error {
+	commit, err := g.lastAppCommit(ctx, app)
+	if err != nil || commit == nil {
+		return err
+	}
+	// other gman processes may be recording views too, so read and
+	// write the file under a lock, or their views would be lost
+	lctx, cancel := context.WithTimeout(ctx, UpdateLockTimeout)
+	defer cancel()
+	lock, err := lockPath(lctx, filepath.Join(g.ConfigDir, viewsFile+".lock"), true)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	v, err := g.readViews()
+	if err != nil {
+		return err
+	}
+	if v[g.Repo.URL] == nil {
+		v[g.Repo.URL] = make(map[string]*View)
+	}
+	v[g.Repo.URL][appKey(app)] = &View{
+		Commit: commit.Hash,
+		Viewed: time.Now(),
+	}
+	return g.writeViews(v)
+}
+
+// LastView returns when the user last viewed the app, or nil if they haven't
+func (g *Gman) LastView(app *App) (*View, error) {
+	v, err := g.readViews()
+	if err != nil {
+		return nil, err
+	}
+	return v[g.Repo.URL][appKey(app)], nil
+}
+
+// ChangedSinceViewed returns the apps the user has viewed before, which
+// have changed since they last viewed them
+func (g *Gman) ChangedSinceViewed(ctx context.Context) ([]App, error) {
+	v, err := g.readViews()
+	if err != nil {
+		return nil, err
+	}
+	var changed []App
+	for _, app := range g.ListApps("") {
+		view := v[g.Repo.URL][appKey(&app)]
+		if view == nil {
+			continue
+		}
+		commit, err := g.lastAppCommit(ctx, &app)
+		if err != nil {
+			return nil, err
+		}
+		if commit != nil && commit.Hash != view.Commit {
+			log.WithFields(log.Fields{
+				"fn":  "ChangedSinceViewed",
+				"app": appKey(&app),
+			}).Debug("app changed")
+			changed = append(changed, app)
+		}
+	}
+	return changed, nil
+}
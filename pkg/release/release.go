@@ -1,6 +1,7 @@
 package release
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -90,7 +91,7 @@ func LoadReleases(dir string) ([]Release, error) {
 	return rs, err
 }
 
-func (r *Release) Readme() (string, error) {
+func (r *Release) Readme(ctx context.Context) (string, error) {
 	if r.ReadmeFile == nil {
 		return "", errors.New("readme file not set")
 	}
@@ -100,7 +101,11 @@ func (r *Release) Readme() (string, error) {
 		return "", err
 	}
 	if utils.IsOnlyUrl(string(b)) {
-		res, err := http.Get(string(b))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(string(b)), nil)
+		if err != nil {
+			return string(b), nil
+		}
+		res, err := http.DefaultClient.Do(req)
 		if err != nil {
 			if OpenURLOnGetFailure {
 				utils.OpenURL(string(b))